@@ -5,9 +5,26 @@ import (
 	"os"
 )
 
-// envy init SHELL
+// envy init [SHELL]
 // envy export
 // envy gen
+// envy hook
+// envy check
+// envy reload
+// envy status [--json]
+// envy suspend
+// envy resume
+// envy reset
+// envy use DIR|--clear
+// envy profile use PROFILE|--clear
+// envy profile list
+// envy profile current
+// envy history
+// envy back
+// envy completion SHELL
+// envy daemon
+// envy doctor
+// envy env [--dir DIR] [--format FORMAT] [--profile PROFILE] [--managed-only] [--prefix PREFIX]
 
 func main() {
 	if err := cmd.Execute(); err != nil {
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"envy/internal/app/shared"
+	"envy/internal/app/shell"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var backCmd = &cobra.Command{
+	Use:   "back",
+	Short: "Return to the environment loaded before the last one",
+	Long: `Loads the environment that was active before the last transition in the session before the next prompt,
+as loaded from the directory it was loaded from. It stays loaded until the next change of directory (or of the
+envy files), which loads the envy files as usual. Running it twice goes back and forth between the last two
+environments.`,
+	Args: cobra.NoArgs,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return genPreRun(cmd)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return backRun(cmd)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(backCmd)
+}
+
+func backRun(cmd *cobra.Command) error {
+	sh := cmd.Context().Value("shell").(shell.Shell)
+	sessionKey, _ := cmd.Context().Value("sessionKey").(string)
+
+	if len(os.Getenv("ENVY_STATELESS")) > 0 {
+		return errStateless
+	}
+
+	currentDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	lock, err := shared.LockSession(sessionKey, shell.Timeout()+lockTimeoutMargin)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	state, err := shared.LoadSessionState(sessionKey)
+	if err != nil && !errors.Is(err, shared.ErrNoSessionState) {
+		return err
+	}
+
+	if state == nil || len(state.History) < 2 {
+		return errors.New("there is no previous environment in the history of this session")
+	}
+
+	previous := state.History[len(state.History)-2]
+
+	// files deleted since can't be loaded again
+	var loadPaths []string
+	for _, path := range previous.Paths {
+		if shared.Exists(path) {
+			loadPaths = append(loadPaths, path)
+		}
+	}
+
+	keyFilepath := shared.SessionFilepath(sessionKey, "key")
+
+	written, evalErr := transition(cmd, sh, sessionKey, state, shared.Exists(keyFilepath), false, previous.Dir, loadPaths, fmt.Sprintf("back to %s", previous.Dir))
+	if !written {
+		return evalErr
+	}
+
+	// the session mode is left alone: the key says the envy files of the current directory are loaded so the
+	// hooks source the scripts written above at the next prompt without generating them again, and the next
+	// change loads the envy files as usual
+	err = writeKey(shared.LoadPathsKey(sessionLoadPaths(sh, sessionKey, currentDir)), keyFilepath)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(shared.SessionFilepath(sessionKey, "checked"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return evalErr
+}
@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"context"
+	"envy/internal/app/shared"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestBackRun(t *testing.T) {
+	tmp := t.TempDir()
+
+	tests := []struct {
+		name    string
+		history []shared.Transition
+	}{
+		{
+			name: "no history",
+		},
+		{
+			name:    "single transition",
+			history: []shared.Transition{{Dir: tmp, Paths: []string{"envy.sh"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+			t.Setenv("ENVY_STATELESS", "")
+
+			ctx := context.WithValue(context.Background(), "shell", &fakeShell{})
+			ctx = context.WithValue(ctx, "sessionKey", "12345678")
+			backCmd.SetContext(ctx)
+
+			if tt.history != nil {
+				state := &shared.SessionState{Version: shared.SessionStateVersion, History: tt.history}
+				if err := state.Save("12345678"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := backRun(backCmd); err == nil {
+				t.Fatal("backRun() expected an error without a previous environment")
+			}
+		})
+	}
+}
+
+func TestBackRun_Transition(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("ENVY_STATELESS", "")
+
+	for _, name := range []string{"a", "b", "c"} {
+		os.Mkdir(filepath.Join(tmp, name), 0755)
+		os.WriteFile(filepath.Join(tmp, name, "envy.sh"), []byte("export ENVY_BACK_"+name+"=1"), 0644)
+	}
+
+	var loaded []string
+	var undone []shared.EnvChange
+	var scripts int
+
+	fake := &fakeShell{
+		findLoadPaths: func(dir string) []string { return shared.FindLoadPaths(dir, "envy.sh", "") },
+		genLoadFile: func(paths []string) ([]string, string) {
+			loaded = paths
+			scripts++
+			return []string{}, filepath.Join(tmp, "session.load.sh")
+		},
+		genUndoFile: func(changes []shared.EnvChange) ([]string, string) {
+			undone = changes
+			return []string{}, filepath.Join(tmp, "session.undo.sh")
+		},
+	}
+
+	ctx := context.WithValue(context.Background(), "shell", fake)
+	ctx = context.WithValue(ctx, "sessionKey", "12345678")
+	genCmd.SetContext(ctx)
+	backCmd.SetContext(ctx)
+	genCmd.SetErr(io.Discard)
+	backCmd.SetErr(io.Discard)
+	defer genCmd.SetErr(nil)
+	defer backCmd.SetErr(nil)
+
+	// the hooks ran in a and then in b, which loads b on top of a's undone env
+	for _, name := range []string{"a", "b"} {
+		t.Chdir(filepath.Join(tmp, name))
+
+		if err := genRun(genCmd); err != nil {
+			t.Fatalf("genRun() unexpected error: %v", err)
+		}
+	}
+
+	t.Setenv("ENVY_BACK_b", "1")
+
+	if err := backRun(backCmd); err != nil {
+		t.Fatalf("backRun() unexpected error: %v", err)
+	}
+
+	if want := []string{filepath.Join(tmp, "a", "envy.sh")}; !slices.Equal(loaded, want) {
+		t.Errorf("backRun() loaded %v, want %v", loaded, want)
+	}
+
+	if want := []shared.EnvChange{{Key: "ENVY_BACK_b", NewValue: "1"}}; !slices.Equal(undone, want) {
+		t.Errorf("backRun() undid %+v, want %+v", undone, want)
+	}
+
+	if len(pinnedDir("12345678")) > 0 || isSuspended("12345678") {
+		t.Error("expected back to leave the session mode alone")
+	}
+
+	if shared.Exists(shared.SessionFilepath("12345678", "checked")) {
+		t.Error("expected the hooks to run at the next prompt to source the scripts")
+	}
+
+	state, err := shared.LoadSessionState("12345678")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if last := state.History[len(state.History)-1]; last.Dir != filepath.Join(tmp, "a") {
+		t.Errorf("expected the history to end with the environment of a, got %+v", last)
+	}
+
+	// the next prompt sources the scripts written by back rather than generating them again
+	scripts = 0
+
+	if err := genRun(genCmd); err != nil {
+		t.Fatalf("genRun() unexpected error: %v", err)
+	}
+
+	if scripts != 0 {
+		t.Error("expected gen to keep the scripts written by back")
+	}
+
+	// changing directory afterwards loads as usual
+	os.Unsetenv("ENVY_BACK_b")
+	t.Setenv("ENVY_BACK_a", "1")
+	t.Chdir(filepath.Join(tmp, "c"))
+
+	if err := genRun(genCmd); err != nil {
+		t.Fatalf("genRun() unexpected error: %v", err)
+	}
+
+	if want := []string{filepath.Join(tmp, "c", "envy.sh")}; !slices.Equal(loaded, want) {
+		t.Errorf("genRun() loaded %v after back, want %v", loaded, want)
+	}
+
+	if want := []shared.EnvChange{{Key: "ENVY_BACK_a", NewValue: "1"}}; !slices.Equal(undone, want) {
+		t.Errorf("genRun() undid %+v after back, want %+v", undone, want)
+	}
+}
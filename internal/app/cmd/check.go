@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"envy/internal/app/shared"
+	"envy/internal/app/shell"
+	"errors"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var errChanged = errors.New("envy files changed since the last gen")
+
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check whether envy files changed since the last gen",
+	Long: `Exits with a non-zero status when envy.sh files were created, modified or deleted since the last gen
+for the session (or a reload was requested, or checking out another git branch changed the overlays that apply).
+This command is usually called by the shell hooks before each prompt.`,
+	Args: cobra.NoArgs,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return genPreRun(cmd)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// the exit status is the answer so there is nothing to print
+		cmd.SilenceErrors = true
+		cmd.SilenceUsage = true
+		return checkRun(cmd)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(checkCmd)
+}
+
+func checkRun(cmd *cobra.Command) error {
+	sh := cmd.Context().Value("shell").(shell.Shell)
+	sessionKey, _ := cmd.Context().Value("sessionKey").(string)
+
+	currentDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	key := shared.LoadPathsKey(sessionLoadPaths(sh, sessionKey, currentDir))
+
+	checkedKey, err := os.ReadFile(shared.SessionFilepath(sessionKey, "checked"))
+	if err != nil || string(checkedKey) != key {
+		return errChanged
+	}
+
+	return nil
+}
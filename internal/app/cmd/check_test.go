@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"context"
+	"envy/internal/app/shared"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckRun(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+
+	envyFilepath := filepath.Join(tmp, "envy.sh")
+	if err := os.WriteFile(envyFilepath, []byte("export FOO=bar"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loadPaths := []string{envyFilepath}
+
+	fake := &fakeShell{
+		findLoadPaths: func(_ string) []string { return loadPaths },
+	}
+
+	ctx := context.WithValue(context.Background(), "shell", fake)
+	ctx = context.WithValue(ctx, "sessionKey", "12345678")
+	checkCmd.SetContext(ctx)
+
+	tests := []struct {
+		name    string
+		setup   func()
+		wantErr bool
+	}{
+		{
+			name:    "never generated",
+			setup:   func() {},
+			wantErr: true,
+		},
+		{
+			name: "unchanged",
+			setup: func() {
+				writeKey(shared.LoadPathsKey(loadPaths), shared.SessionFilepath("12345678", "checked"))
+			},
+			wantErr: false,
+		},
+		{
+			name: "modified",
+			setup: func() {
+				os.WriteFile(envyFilepath, []byte("export FOO=bar BAR=baz"), 0644)
+			},
+			wantErr: true,
+		},
+		{
+			name: "created",
+			setup: func() {
+				writeKey(shared.LoadPathsKey(loadPaths), shared.SessionFilepath("12345678", "checked"))
+				loadPaths = append(loadPaths, filepath.Join(tmp, "envy.d", "local.sh"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setup()
+
+			err := checkRun(checkCmd)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkRun() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil && !errors.Is(err, errChanged) {
+				t.Errorf("checkRun() error = %v, want %v", err, errChanged)
+			}
+		})
+	}
+}
+
+func TestCheckRun_Branch(t *testing.T) {
+	tmp, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HOME", tmp)
+
+	os.MkdirAll(filepath.Join(tmp, ".git"), 0755)
+	os.WriteFile(filepath.Join(tmp, "envy.sh"), []byte("export FOO=bar"), 0644)
+	os.WriteFile(filepath.Join(tmp, "envy.branch.feature-x.sh"), []byte("export FEATURE_X=1"), 0644)
+
+	head := filepath.Join(tmp, ".git", "HEAD")
+	os.WriteFile(head, []byte("ref: refs/heads/main\n"), 0644)
+
+	fake := &fakeShell{
+		findLoadPaths: func(dir string) []string { return shared.FindLoadPaths(dir, "envy.sh", "") },
+	}
+
+	ctx := context.WithValue(context.Background(), "shell", fake)
+	ctx = context.WithValue(ctx, "sessionKey", "12345678")
+	checkCmd.SetContext(ctx)
+
+	t.Chdir(tmp)
+
+	writeKey(shared.LoadPathsKey(fake.FindLoadPaths(tmp, "")), shared.SessionFilepath("12345678", "checked"))
+
+	// branches without an overlay load the same files
+	os.WriteFile(head, []byte("ref: refs/heads/fix\n"), 0644)
+
+	if err := checkRun(checkCmd); err != nil {
+		t.Errorf("checkRun() unexpected error after switching to a branch without an overlay: %v", err)
+	}
+
+	os.WriteFile(head, []byte("ref: refs/heads/feature/x\n"), 0644)
+
+	if err := checkRun(checkCmd); !errors.Is(err, errChanged) {
+		t.Errorf("checkRun() error = %v after switching to a branch with an overlay, want %v", err, errChanged)
+	}
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"envy/internal/app/shared"
+	"envy/internal/app/shell"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// completions for commands and flags that take a shell type, an output format or a variable name (the
+// completion command itself is provided by cobra and its script is registered by init)
+
+func completeShellTypes(_ *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	return shell.SupportedShellTypes, cobra.ShellCompDirectiveNoFileComp
+}
+
+func completeFormats(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return shared.SupportedFormats, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeProfiles offers the profiles of the directory the session loads the envy files of
+func completeProfiles(cmd *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 || genPreRun(cmd) != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	return profileNames(cmd), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeManagedVars offers the names of the variables envy loaded in the current session
+func completeManagedVars(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	var names []string
+
+	for _, name := range managedVarNames() {
+		if strings.HasPrefix(name, toComplete) {
+			names = append(names, name)
+		}
+	}
+
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// managedVarNames returns the names of the variables loaded in the session
+func managedVarNames() []string {
+	var names []string
+	for _, change := range sessionChanges() {
+		names = append(names, change.Key)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// sessionChanges reads the changes loaded in the session from ENVY_STATE in stateless sessions and from the
+// session state otherwise
+func sessionChanges() []shared.EnvChange {
+	if len(os.Getenv("ENVY_STATELESS")) > 0 {
+		state, err := shared.DecodeState(os.Getenv("ENVY_STATE"))
+		if err != nil {
+			return nil
+		}
+
+		return state.Changes
+	}
+
+	sessionKey := os.Getenv("ENVY_SESSION_KEY")
+	if len(sessionKey) == 0 {
+		return nil
+	}
+
+	state, err := shared.LoadSessionState(sessionKey)
+	if err != nil {
+		return nil
+	}
+
+	return state.Changes
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"bytes"
+	"envy/internal/app/shared"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCompletion(t *testing.T) {
+	state, err := shared.EncodeState(shared.State{Changes: []shared.EnvChange{{Key: "FOO", NewValue: "bar"}, {Key: "API_URL", NewValue: "http://localhost"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		want     []string
+		dontWant []string
+	}{
+		{
+			name: "script",
+			args: []string{"completion", "zsh"},
+			want: []string{"#compdef envy"},
+		},
+		{
+			name: "commands",
+			args: []string{"__complete", ""},
+			want: []string{"init", "gen", "env", "doctor"},
+		},
+		{
+			name: "shell types",
+			args: []string{"__complete", "init", ""},
+			want: []string{"zsh"},
+		},
+		{
+			name:     "single shell type",
+			args:     []string{"__complete", "init", "zsh", ""},
+			dontWant: []string{"zsh"},
+		},
+		{
+			name: "formats",
+			args: []string{"__complete", "env", "--format", ""},
+			want: []string{"dotenv", "json", "github"},
+		},
+		{
+			name:     "managed vars",
+			args:     []string{"__complete", "env", "--prefix", "F"},
+			want:     []string{"FOO"},
+			dontWant: []string{"API_URL"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ENVY_STATELESS", "1")
+			t.Setenv("ENVY_STATE", state)
+
+			var buf bytes.Buffer
+
+			rootCmd.SetArgs(tt.args)
+			rootCmd.SetOut(&buf)
+			rootCmd.SetErr(io.Discard)
+
+			if err := Execute(); err != nil {
+				t.Fatalf("Execute() unexpected error: %v", err)
+			}
+
+			for _, want := range tt.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("expected the output to contain %q, got:\n%s", want, buf.String())
+				}
+			}
+
+			for _, dontWant := range tt.dontWant {
+				if strings.Contains(buf.String(), dontWant) {
+					t.Errorf("expected the output not to contain %q, got:\n%s", dontWant, buf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestManagedVarNames(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("ENVY_SESSION_KEY", "12345678")
+	t.Setenv("ENVY_STATELESS", "1")
+	t.Setenv("ENVY_STATE", "!!!")
+
+	if names := managedVarNames(); len(names) != 0 {
+		t.Errorf("managedVarNames() = %v, want none for an invalid state", names)
+	}
+
+	// the session state is read when the session isn't stateless
+	t.Setenv("ENVY_STATELESS", "")
+
+	state := &shared.SessionState{
+		Version: shared.SessionStateVersion,
+		Changes: []shared.EnvChange{{Key: "FOO", NewValue: "bar"}, {Key: "BAR", OldValue: "baz"}},
+	}
+	if err := state.Save("12345678"); err != nil {
+		t.Fatal(err)
+	}
+
+	if names := managedVarNames(); strings.Join(names, " ") != "BAR FOO" {
+		t.Errorf("managedVarNames() = %v, want [BAR FOO]", names)
+	}
+}
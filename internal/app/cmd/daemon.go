@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"context"
+	"envy/internal/app/daemon"
+	"envy/internal/app/shell"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/spf13/cobra"
+)
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Run a per-user daemon that keeps evaluated environments warm",
+	Long: `Run a per-user daemon listening on a unix socket (in XDG_RUNTIME_DIR) that evaluates envy files on
+behalf of 'envy gen', caches the results and re-evaluates them as soon as a watched file changes.
+'envy gen' falls back to evaluating in-process whenever the daemon isn't running.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return daemonRun(cmd.Context(), daemon.SocketPath())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(daemonCmd)
+}
+
+func daemonRun(ctx context.Context, socketPath string) error {
+	err := os.MkdirAll(filepath.Dir(socketPath), 0700)
+	if err != nil {
+		return err
+	}
+
+	// only one daemon per user; exit quietly when another one is already answering
+	if conn, err := net.Dial("unix", socketPath); err == nil {
+		conn.Close()
+		return nil
+	}
+
+	// the socket file is left behind when a daemon is killed so remove it before listening
+	os.Remove(socketPath)
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(socketPath)
+
+	err = os.Chmod(socketPath, 0600)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+
+	server, err := daemon.NewServer(daemonEval)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	defer server.Close()
+
+	// keep running when the terminal that started the daemon is closed
+	signal.Ignore(syscall.SIGHUP)
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	err = server.Serve(listener)
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return err
+}
+
+func daemonEval(ctx context.Context, request daemon.Request) ([]string, error) {
+	sh := shell.NewShell(request.Shell, "")
+	if sh == nil {
+		return nil, fmt.Errorf("%s is not a supported shell type", request.Shell)
+	}
+
+	// honour the timeout of the session that sent the request rather than the daemon's own
+	timeout := request.Timeout
+	if timeout <= 0 {
+		timeout = shell.Timeout()
+	}
+
+	env, err := evalEnv(ctx, sh, request.Paths, request.Dir, request.Environ, timeout, io.Discard)
+	if err != nil {
+		return nil, err
+	}
+
+	return env.Environ(), nil
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"context"
+	"envy/internal/app/daemon"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDaemonRun(t *testing.T) {
+	tmp := t.TempDir()
+	socketPath := filepath.Join(tmp, "envy", "daemon.sock")
+
+	envyFilepath := filepath.Join(tmp, "envy.sh")
+	if err := os.WriteFile(envyFilepath, []byte("export FOO=bar"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error)
+	go func() { done <- daemonRun(ctx, socketPath) }()
+
+	// wait for the daemon to answer
+	var got []string
+	var err error
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		got, err = daemon.Eval(context.Background(), socketPath, daemon.Request{Shell: "test", Dir: tmp, Environ: []string{"HOME=/home/test"}, Paths: []string{envyFilepath}})
+		if err == nil {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err != nil {
+		t.Fatalf("daemon.Eval() unexpected error: %v", err)
+	}
+
+	want := []string{"FOO=bar", "HOME=/home/test"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("daemon.Eval() = %v, want %v", got, want)
+	}
+
+	// a second daemon exits straight away while the first one is running
+	if err := daemonRun(context.Background(), socketPath); err != nil {
+		t.Errorf("daemonRun() for a second daemon unexpected error: %v", err)
+	}
+
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("daemonRun() unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the daemon to stop")
+	}
+
+	if _, err := os.Stat(socketPath); !os.IsNotExist(err) {
+		t.Errorf("expected the socket to be removed, got %v", err)
+	}
+}
+
+func TestDaemonEval(t *testing.T) {
+	_, err := daemonEval(context.Background(), daemon.Request{Shell: "unsupported"})
+
+	if err == nil {
+		t.Error("daemonEval() expected an error for an unsupported shell")
+	}
+}
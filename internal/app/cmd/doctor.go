@@ -0,0 +1,253 @@
+package cmd
+
+import (
+	"envy/internal/app/shared"
+	"envy/internal/app/shell"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/spf13/cobra"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Diagnose the envy installation and session",
+	Long: `Checks that envy is installed and initialized correctly for the current shell session and prints how to
+fix each problem found.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return doctorRun(cmd.OutOrStdout())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
+
+// diagnosis is the outcome of a single doctor check; problem is empty when the check passed
+type diagnosis struct {
+	check   string
+	detail  string
+	problem string
+	fix     string
+}
+
+func doctorRun(writer io.Writer) error {
+	shellType := os.Getenv("ENVY_SHELL")
+	sessionKey := os.Getenv("ENVY_SESSION_KEY")
+
+	// the installation checks still apply to the default shell when the session isn't initialized
+	checkShellType := shellType
+	if !slices.Contains(shell.SupportedShellTypes, checkShellType) {
+		checkShellType = shell.SupportedShellTypes[0]
+	}
+
+	sh := shell.NewShell(checkShellType, sessionKey)
+	initFix := fmt.Sprintf(`add eval "$(envy init %s)" to your shell's rc file and start a new shell`, checkShellType)
+
+	diagnoses := []diagnosis{
+		diagnosePath(),
+		diagnoseShellType(shellType, initFix),
+		diagnoseSessionKey(sessionKey, initFix),
+		diagnoseHooks(sessionKey, initFix),
+		diagnoseCacheDir(),
+		diagnoseSubshell(sh),
+	}
+
+	switch {
+	case len(os.Getenv("ENVY_STATELESS")) > 0:
+		diagnoses = append(diagnoses, diagnoseState(os.Getenv("ENVY_STATE")))
+	case len(sessionKey) > 0:
+		diagnoses = append(diagnoses, diagnoseSessionState(sessionKey))
+	}
+
+	var problems int
+
+	for _, d := range diagnoses {
+		if len(d.problem) == 0 {
+			fmt.Fprintf(writer, "[ok]   %s: %s\n", d.check, d.detail)
+			continue
+		}
+
+		problems++
+		fmt.Fprintf(writer, "[fail] %s: %s\n       fix: %s\n", d.check, d.problem, d.fix)
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("found %d problem(s)", problems)
+	}
+
+	return nil
+}
+
+func diagnosePath() diagnosis {
+	d := diagnosis{check: "envy on PATH"}
+
+	path, err := exec.LookPath("envy")
+	if err != nil {
+		d.problem = "the shell hooks run envy by name but it isn't on PATH"
+		d.fix = "add the directory containing the envy binary (e.g. $(go env GOPATH)/bin) to PATH"
+		return d
+	}
+
+	d.detail = path
+	return d
+}
+
+func diagnoseShellType(shellType string, initFix string) diagnosis {
+	d := diagnosis{check: "ENVY_SHELL"}
+
+	switch {
+	case len(shellType) == 0:
+		d.problem = "not set, the shell hasn't been initialized"
+		d.fix = initFix
+	case !slices.Contains(shell.SupportedShellTypes, shellType):
+		d.problem = fmt.Sprintf("%s is not a supported shell type; valid values are [%s]", shellType, strings.Join(shell.SupportedShellTypes, ", "))
+		d.fix = initFix
+	default:
+		d.detail = shellType
+	}
+
+	return d
+}
+
+func diagnoseSessionKey(sessionKey string, initFix string) diagnosis {
+	d := diagnosis{check: "ENVY_SESSION_KEY"}
+
+	if len(sessionKey) == 0 {
+		d.problem = "not set, the shell hasn't been initialized"
+		d.fix = initFix
+		return d
+	}
+
+	if _, err := ulid.ParseStrict(sessionKey); err != nil {
+		d.problem = fmt.Sprintf("%s is not a valid session key: %v", sessionKey, err)
+		d.fix = "don't set ENVY_SESSION_KEY yourself; unset it and start a new shell so init creates one"
+		return d
+	}
+
+	d.detail = sessionKey
+	return d
+}
+
+// diagnoseHooks looks for what the hooks leave behind in the current session (the files only gen writes, or
+// ENVY_STATE in stateless sessions) rather than starting another shell, which would create a session of its own;
+// the session state doesn't count since init writes it to record the baseline
+func diagnoseHooks(sessionKey string, initFix string) diagnosis {
+	d := diagnosis{check: "shell hooks"}
+
+	if len(sessionKey) == 0 {
+		d.problem = "no session, the hooks can't have run"
+		d.fix = initFix
+		return d
+	}
+
+	if len(os.Getenv("ENVY_STATELESS")) > 0 {
+		if len(os.Getenv("ENVY_STATE")) == 0 {
+			d.problem = "envy hook hasn't run in this shell, so changing directories won't load anything"
+			d.fix = initFix
+			return d
+		}
+
+		d.detail = "envy hook ran in this shell"
+		return d
+	}
+
+	if !shared.Exists(shared.SessionFilepath(sessionKey, "checked")) && !shared.Exists(shared.SessionFilepath(sessionKey, "key")) {
+		d.problem = "envy gen hasn't run in this shell, so changing directories won't load anything"
+		d.fix = initFix
+		return d
+	}
+
+	d.detail = "envy gen ran in this shell"
+	return d
+}
+
+func diagnoseCacheDir() diagnosis {
+	d := diagnosis{check: "cache dir"}
+
+	cacheDir := shared.CacheDir()
+	fix := fmt.Sprintf("make sure you own %s (e.g. chown -R $USER %s)", cacheDir, cacheDir)
+
+	err := os.MkdirAll(cacheDir, 0755)
+	if err != nil {
+		d.problem = fmt.Sprintf("could not create %s: %v", cacheDir, err)
+		d.fix = fix
+		return d
+	}
+
+	file, err := os.CreateTemp(cacheDir, "doctor.*.tmp")
+	if err != nil {
+		d.problem = fmt.Sprintf("%s is not writable: %v", cacheDir, err)
+		d.fix = fix
+		return d
+	}
+
+	file.Close()
+	os.Remove(file.Name())
+
+	d.detail = fmt.Sprintf("%s is writable", cacheDir)
+	return d
+}
+
+func diagnoseSubshell(sh shell.Shell) diagnosis {
+	d := diagnosis{check: "subshell"}
+
+	name := sh.GetSubshellCmd(nil).Args[0]
+
+	path, err := exec.LookPath(name)
+	if err != nil {
+		d.problem = fmt.Sprintf("%s is needed to evaluate envy.sh files but isn't on PATH", name)
+		d.fix = fmt.Sprintf("install %s or add its directory to PATH", name)
+		return d
+	}
+
+	d.detail = path
+	return d
+}
+
+func diagnoseSessionState(sessionKey string) diagnosis {
+	d := diagnosis{check: "session state"}
+
+	state, err := shared.LoadSessionState(sessionKey)
+	if errors.Is(err, shared.ErrNoSessionState) {
+		d.problem = fmt.Sprintf("missing %s, the hooks haven't run (or gen failed) in this session", shared.SessionStateFilepath(sessionKey))
+		d.fix = "run envy reload and check the output of the next prompt for errors"
+		return d
+	}
+	if err != nil {
+		d.problem = err.Error()
+		d.fix = fmt.Sprintf("remove %s and start a new shell", shared.SessionStateFilepath(sessionKey))
+		return d
+	}
+
+	d.detail = fmt.Sprintf("%d file(s) loaded in %d layer(s)", len(state.LoadPaths), len(state.Layers))
+	return d
+}
+
+func diagnoseState(encoded string) diagnosis {
+	d := diagnosis{check: "ENVY_STATE"}
+
+	if len(encoded) == 0 {
+		d.problem = "not set, the hooks haven't run in this session"
+		d.fix = "make sure ENVY_STATELESS is set before envy init runs and start a new shell"
+		return d
+	}
+
+	state, err := shared.DecodeState(encoded)
+	if err != nil {
+		d.problem = fmt.Sprintf("could not be decoded: %v", err)
+		d.fix = "unset ENVY_STATE and start a new shell"
+		return d
+	}
+
+	d.detail = fmt.Sprintf("%d change(s) loaded", len(state.Changes))
+	return d
+}
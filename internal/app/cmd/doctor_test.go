@@ -0,0 +1,229 @@
+package cmd
+
+import (
+	"bytes"
+	"envy/internal/app/shared"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestDoctorRun(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("ENVY_SHELL", "")
+	t.Setenv("ENVY_SESSION_KEY", "")
+
+	var buf bytes.Buffer
+
+	if err := doctorRun(&buf); err == nil {
+		t.Error("doctorRun() expected an error for an uninitialized session")
+	}
+
+	for _, want := range []string{"[fail] ENVY_SHELL", "[fail] ENVY_SESSION_KEY", "fix: add eval", "[ok]   cache dir"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected the output to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestDiagnoseShellType(t *testing.T) {
+	tests := []struct {
+		name        string
+		shellType   string
+		wantProblem bool
+	}{
+		{name: "not set", shellType: "", wantProblem: true},
+		{name: "unsupported", shellType: "fish", wantProblem: true},
+		{name: "supported", shellType: "zsh", wantProblem: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := diagnoseShellType(tt.shellType, "fix")
+
+			if (len(d.problem) > 0) != tt.wantProblem {
+				t.Errorf("diagnoseShellType() problem = %q, wantProblem %v", d.problem, tt.wantProblem)
+			}
+		})
+	}
+}
+
+func TestDiagnoseSessionKey(t *testing.T) {
+	tests := []struct {
+		name        string
+		sessionKey  string
+		wantProblem bool
+	}{
+		{name: "not set", sessionKey: "", wantProblem: true},
+		{name: "invalid", sessionKey: "12345678", wantProblem: true},
+		{name: "valid", sessionKey: "01ARZ3NDEKTSV4RRFFQ69G5FAV", wantProblem: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := diagnoseSessionKey(tt.sessionKey, "fix")
+
+			if (len(d.problem) > 0) != tt.wantProblem {
+				t.Errorf("diagnoseSessionKey() problem = %q, wantProblem %v", d.problem, tt.wantProblem)
+			}
+		})
+	}
+}
+
+func TestDiagnoseHooks(t *testing.T) {
+	tests := []struct {
+		name        string
+		sessionKey  string
+		stateless   string
+		state       string
+		files       []string
+		wantProblem bool
+	}{
+		{name: "no session", sessionKey: "", wantProblem: true},
+		{name: "gen never ran", sessionKey: "12345678", wantProblem: true},
+		{name: "gen checked", sessionKey: "12345678", files: []string{"checked"}, wantProblem: false},
+		{name: "gen loaded", sessionKey: "12345678", files: []string{"key"}, wantProblem: false},
+		{name: "only the baseline", sessionKey: "12345678", files: []string{"state.json"}, wantProblem: true},
+		{name: "hook never ran", sessionKey: "12345678", stateless: "1", wantProblem: true},
+		{name: "hook ran", sessionKey: "12345678", stateless: "1", state: "H4sIAAAAAAAA", wantProblem: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+			t.Setenv("ENVY_STATELESS", tt.stateless)
+			t.Setenv("ENVY_STATE", tt.state)
+
+			for _, suffix := range tt.files {
+				if err := writeKey("key", shared.SessionFilepath(tt.sessionKey, suffix)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			d := diagnoseHooks(tt.sessionKey, "fix")
+
+			if (len(d.problem) > 0) != tt.wantProblem {
+				t.Errorf("diagnoseHooks() problem = %q, wantProblem %v", d.problem, tt.wantProblem)
+			}
+		})
+	}
+}
+
+func TestDiagnoseHooks_Init(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("ENVY_SESSION_KEY", "")
+	t.Setenv("ENVY_STATELESS", "")
+
+	var buf bytes.Buffer
+
+	if err := initRun("zsh", &buf, io.Discard); err != nil {
+		t.Fatalf("initRun() unexpected error: %v", err)
+	}
+
+	sessionKey := regexp.MustCompile(`ENVY_SESSION_KEY=(\S+)`).FindStringSubmatch(buf.String())[1]
+
+	// init records the baseline in the session state but the hooks haven't run yet
+	if d := diagnoseHooks(sessionKey, "fix"); len(d.problem) == 0 {
+		t.Error("diagnoseHooks() expected a problem when only init ran")
+	}
+}
+
+func TestDiagnoseCacheDir(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+
+	if d := diagnoseCacheDir(); len(d.problem) > 0 {
+		t.Errorf("diagnoseCacheDir() unexpected problem: %s", d.problem)
+	}
+
+	// the probe file is cleaned up
+	entries, _ := os.ReadDir(shared.CacheDir())
+	if len(entries) != 0 {
+		t.Errorf("expected an empty cache dir, got %d entries", len(entries))
+	}
+
+	// a file in the way of the cache dir
+	t.Setenv("HOME", filepath.Join(tmp, "file"))
+	os.WriteFile(filepath.Join(tmp, "file"), []byte{}, 0644)
+
+	if d := diagnoseCacheDir(); len(d.problem) == 0 {
+		t.Error("diagnoseCacheDir() expected a problem when the cache dir can't be created")
+	}
+}
+
+func TestDiagnoseSubshell(t *testing.T) {
+	tests := []struct {
+		name        string
+		binary      string
+		wantProblem bool
+	}{
+		{name: "installed", binary: "sh", wantProblem: false},
+		{name: "missing", binary: "envy-missing-shell", wantProblem: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeShell{
+				getSubshellCmd: func(_ []string) *exec.Cmd { return exec.Command(tt.binary) },
+			}
+
+			d := diagnoseSubshell(fake)
+
+			if (len(d.problem) > 0) != tt.wantProblem {
+				t.Errorf("diagnoseSubshell() problem = %q, wantProblem %v", d.problem, tt.wantProblem)
+			}
+		})
+	}
+}
+
+func TestDiagnoseSessionState(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	if d := diagnoseSessionState("12345678"); !strings.Contains(d.problem, "missing") {
+		t.Errorf("diagnoseSessionState() problem = %q, want the state reported missing", d.problem)
+	}
+
+	os.MkdirAll(shared.CacheDir(), 0755)
+	os.WriteFile(shared.SessionStateFilepath("12345678"), []byte("{"), 0644)
+
+	if d := diagnoseSessionState("12345678"); len(d.problem) == 0 {
+		t.Error("diagnoseSessionState() expected a problem for an invalid state")
+	}
+
+	state := &shared.SessionState{Version: shared.SessionStateVersion}
+	if err := state.Save("12345678"); err != nil {
+		t.Fatal(err)
+	}
+
+	if d := diagnoseSessionState("12345678"); len(d.problem) > 0 {
+		t.Errorf("diagnoseSessionState() unexpected problem: %s", d.problem)
+	}
+}
+
+func TestDiagnoseState(t *testing.T) {
+	encoded, _ := shared.EncodeState(shared.State{Key: "abc"})
+
+	tests := []struct {
+		name        string
+		encoded     string
+		wantProblem bool
+	}{
+		{name: "not set", encoded: "", wantProblem: true},
+		{name: "invalid", encoded: "!!!", wantProblem: true},
+		{name: "valid", encoded: encoded, wantProblem: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := diagnoseState(tt.encoded)
+
+			if (len(d.problem) > 0) != tt.wantProblem {
+				t.Errorf("diagnoseState() problem = %q, wantProblem %v", d.problem, tt.wantProblem)
+			}
+		})
+	}
+}
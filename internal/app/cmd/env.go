@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"context"
+	"envy/internal/app/shared"
+	"envy/internal/app/shell"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+)
+
+type envOptions struct {
+	dir         string
+	format      string
+	managedOnly bool
+	profile     string
+	prefixes    []string
+}
+
+var envOpts envOptions
+
+var envCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Print the resolved environment for a directory",
+	Long: `Print the environment that envy resolves for a directory in one of several formats
+(shell, dotenv, json, systemd, docker or github) for use with tools such as docker run --env-file,
+$GITHUB_ENV or systemd EnvironmentFile=.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return envRun(envOpts, cmd.OutOrStdout(), cmd.ErrOrStderr())
+	},
+}
+
+func init() {
+	envCmd.Flags().StringVar(&envOpts.dir, "dir", ".", "directory to resolve the environment for")
+	envCmd.Flags().StringVar(&envOpts.format, "format", "shell", fmt.Sprintf("output format [%s]", strings.Join(shared.SupportedFormats, ", ")))
+	envCmd.Flags().BoolVar(&envOpts.managedOnly, "managed-only", false, "only print the variables changed by envy files (the delta)")
+	envCmd.Flags().StringVar(&envOpts.profile, "profile", "", "profile to load the envy files of (defaults to the session's)")
+	envCmd.Flags().StringSliceVar(&envOpts.prefixes, "prefix", nil, "only print variables starting with the given prefix")
+
+	envCmd.RegisterFlagCompletionFunc("dir", func(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+		return nil, cobra.ShellCompDirectiveFilterDirs
+	})
+	envCmd.RegisterFlagCompletionFunc("format", completeFormats)
+	envCmd.RegisterFlagCompletionFunc("prefix", completeManagedVars)
+
+	rootCmd.AddCommand(envCmd)
+}
+
+func envRun(opts envOptions, writer io.Writer, errWriter io.Writer) error {
+	dir, err := filepath.Abs(opts.dir)
+	if err != nil {
+		return err
+	}
+
+	// default to the first supported shell so the command also works outside an envy session (e.g. in CI)
+	shellType := os.Getenv("ENVY_SHELL")
+	if len(shellType) == 0 {
+		shellType = shell.SupportedShellTypes[0]
+	}
+
+	sh := shell.NewShell(shellType, os.Getenv("ENVY_SESSION_KEY"))
+	if sh == nil {
+		return fmt.Errorf("%s is not a supported shell type", shellType)
+	}
+
+	profile := opts.profile
+	if len(profile) == 0 {
+		profile = sessionProfile(os.Getenv("ENVY_SESSION_KEY"))
+	} else if !shared.ValidProfile(profile) {
+		return fmt.Errorf("%s is not a valid profile; use letters, digits, - and _ only", profile)
+	}
+
+	// resolve on top of the env without what the session loaded, which would otherwise carry over into another
+	// --dir and already be there for --managed-only
+	environ := shared.RevertEnviron(os.Environ(), sessionChanges())
+	oldEnv := shared.NewEnv(environ)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	newEnv, err := evalEnv(ctx, sh, sh.FindLoadPaths(dir, profile), dir, environ, shell.Timeout(), errWriter)
+	if err != nil {
+		return err
+	}
+
+	vars := newEnv.Vars()
+	var unset []string
+
+	if opts.managedOnly {
+		vars = make(map[string]string)
+
+		for _, change := range oldEnv.Diff(newEnv) {
+			// the files are evaluated in dir, so PWD and the other vars the shell maintains itself are left out
+			if slices.Contains(shared.ShellEnvVars, change.Key) {
+				continue
+			}
+
+			if len(change.NewValue) == 0 {
+				unset = append(unset, change.Key)
+			} else {
+				vars[change.Key] = change.NewValue
+			}
+		}
+	}
+
+	if len(opts.prefixes) > 0 {
+		for key := range vars {
+			if !hasAnyPrefix(key, opts.prefixes) {
+				delete(vars, key)
+			}
+		}
+
+		unset = slices.DeleteFunc(unset, func(key string) bool { return !hasAnyPrefix(key, opts.prefixes) })
+	}
+
+	lines, err := shared.FormatEnv(opts.format, vars, unset)
+	if err != nil {
+		return err
+	}
+
+	for _, line := range lines {
+		_, err := io.WriteString(writer, line+"\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
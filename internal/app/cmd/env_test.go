@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"bytes"
+	"envy/internal/app/shared"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnvCmd(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+	}{
+		{
+			name:    "no args",
+			args:    []string{"env"},
+			wantErr: false,
+		},
+		{
+			name:    "with args",
+			args:    []string{"env", "arg1"},
+			wantErr: true,
+		},
+		{
+			name:    "with unsupported format",
+			args:    []string{"env", "--format", "xml"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ENVY_SHELL", "test")
+
+			rootCmd.SetArgs(tt.args)
+			rootCmd.SetOut(io.Discard)
+			rootCmd.SetErr(io.Discard)
+
+			err := envCmd.Execute()
+
+			// reset flags so they don't leak into the next test
+			envOpts = envOptions{dir: ".", format: "shell"}
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("envCmd error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEnvRun(t *testing.T) {
+	profileDir := t.TempDir()
+	os.WriteFile(filepath.Join(profileDir, "envy.sh"), []byte("export ENVY_TEST_VAR=base"), 0644)
+	os.WriteFile(filepath.Join(profileDir, "envy.dev.sh"), []byte("export ENVY_TEST_VAR=dev"), 0644)
+
+	tests := []struct {
+		name       string
+		shellType  string
+		opts       envOptions
+		wantOutput string
+		wantErr    bool
+	}{
+		{
+			name:       "resolved env",
+			shellType:  "test",
+			opts:       envOptions{dir: t.TempDir(), format: "shell", prefixes: []string{"ENVY_TEST_"}},
+			wantOutput: "export ENVY_TEST_VAR='value'\n",
+		},
+		{
+			name:       "managed only",
+			shellType:  "test",
+			opts:       envOptions{dir: t.TempDir(), format: "shell", managedOnly: true, prefixes: []string{"ENVY_TEST_"}},
+			wantOutput: "",
+		},
+		{
+			name:       "profile",
+			shellType:  "zsh",
+			opts:       envOptions{dir: profileDir, format: "shell", profile: "dev", prefixes: []string{"ENVY_TEST_"}},
+			wantOutput: "export ENVY_TEST_VAR='dev'\n",
+		},
+		{
+			name:      "invalid profile",
+			shellType: "test",
+			opts:      envOptions{dir: t.TempDir(), format: "shell", profile: "../dev"},
+			wantErr:   true,
+		},
+		{
+			name:      "unsupported shell",
+			shellType: "unsupported",
+			opts:      envOptions{dir: t.TempDir(), format: "shell"},
+			wantErr:   true,
+		},
+		{
+			name:      "unsupported format",
+			shellType: "test",
+			opts:      envOptions{dir: t.TempDir(), format: "xml"},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the test shell never finds any load paths so the resolved env is the current env
+			t.Setenv("ENVY_SHELL", tt.shellType)
+			t.Setenv("ENVY_TEST_VAR", "value")
+
+			var buf bytes.Buffer
+
+			err := envRun(tt.opts, &buf, io.Discard)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("envRun() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && buf.String() != tt.wantOutput {
+				t.Errorf("envRun() output = %q, want %q", buf.String(), tt.wantOutput)
+			}
+		})
+	}
+}
+
+func TestEnvRun_Session(t *testing.T) {
+	tmp := t.TempDir()
+
+	projectDir := filepath.Join(tmp, "project")
+	otherDir := filepath.Join(tmp, "other")
+	os.MkdirAll(projectDir, 0755)
+	os.MkdirAll(otherDir, 0755)
+	os.WriteFile(filepath.Join(projectDir, "envy.sh"), []byte("export ENVY_TEST_VAR=bar"), 0644)
+
+	changes := []shared.EnvChange{{Key: "ENVY_TEST_VAR", NewValue: "bar"}}
+
+	tests := []struct {
+		name       string
+		stateless  bool
+		opts       envOptions
+		wantOutput string
+	}{
+		{
+			name:       "managed only",
+			opts:       envOptions{dir: projectDir, format: "shell", managedOnly: true},
+			wantOutput: "export ENVY_TEST_VAR='bar'\n",
+		},
+		{
+			name:       "managed only in a stateless session",
+			stateless:  true,
+			opts:       envOptions{dir: projectDir, format: "shell", managedOnly: true},
+			wantOutput: "export ENVY_TEST_VAR='bar'\n",
+		},
+		{
+			name:       "other dir",
+			opts:       envOptions{dir: otherDir, format: "shell", prefixes: []string{"ENVY_TEST_"}},
+			wantOutput: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the shell runs in a session which loaded the project already
+			t.Setenv("HOME", t.TempDir())
+			t.Setenv("ENVY_SHELL", "zsh")
+			t.Setenv("ENVY_SESSION_KEY", "12345678")
+			t.Setenv("ENVY_STATELESS", "")
+			t.Setenv("ENVY_STATE", "")
+			t.Setenv("ENVY_TEST_VAR", "bar")
+
+			if tt.stateless {
+				encoded, err := shared.EncodeState(shared.State{Changes: changes})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				t.Setenv("ENVY_STATELESS", "1")
+				t.Setenv("ENVY_STATE", encoded)
+			} else {
+				state := &shared.SessionState{Version: shared.SessionStateVersion, Changes: changes}
+				if err := state.Save("12345678"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var buf bytes.Buffer
+
+			if err := envRun(tt.opts, &buf, io.Discard); err != nil {
+				t.Fatalf("envRun() unexpected error: %v", err)
+			}
+
+			if buf.String() != tt.wantOutput {
+				t.Errorf("envRun() output = %q, want %q", buf.String(), tt.wantOutput)
+			}
+		})
+	}
+}
+
+func TestHasAnyPrefix(t *testing.T) {
+	if !hasAnyPrefix("FOO_BAR", []string{"BAZ_", "FOO_"}) {
+		t.Error("expected FOO_BAR to match FOO_")
+	}
+
+	if hasAnyPrefix("FOO_BAR", []string{"BAR"}) {
+		t.Error("expected FOO_BAR not to match BAR")
+	}
+}
@@ -1,16 +1,31 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
+	"envy/internal/app/daemon"
+	"envy/internal/app/posix"
 	"envy/internal/app/shared"
 	"envy/internal/app/shell"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
+var onErrorPolicies = []string{"keep", "partial"}
+
+// how much longer than evaluating the load paths may take gen waits for another run in the session to finish
+var lockTimeoutMargin = 5 * time.Second
+
 var genCmd = &cobra.Command{
 	Use:   "gen",
 	Short: "Generate load and unload sh scripts",
@@ -20,6 +35,8 @@ var genCmd = &cobra.Command{
 		return genPreRun(cmd)
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
+		// failures from here on are about the envy files rather than how the command was used
+		cmd.SilenceUsage = true
 		return genRun(cmd)
 	},
 }
@@ -42,6 +59,7 @@ func genPreRun(cmd *cobra.Command) error {
 	// add the shell to the command context so we can use it during Run
 	ctx := cmd.Context()
 	ctx = context.WithValue(ctx, "shell", sh)
+	ctx = context.WithValue(ctx, "sessionKey", sessionKey)
 	cmd.SetContext(ctx)
 
 	return nil
@@ -50,44 +68,417 @@ func genPreRun(cmd *cobra.Command) error {
 func genRun(cmd *cobra.Command) error {
 	// retrieve the shell from the command context
 	sh := cmd.Context().Value("shell").(shell.Shell)
-
-	// capture current env
-	oldEnv := shared.NewEnv(os.Environ())
+	sessionKey, _ := cmd.Context().Value("sessionKey").(string)
 
 	// find load paths (sh specific)
-	loadPaths := sh.FindLoadPaths()
+	currentDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	// the envy files are evaluated in the directory they are loaded for, which envy use may have pinned
+	loadDir := sessionDir(sessionKey, currentDir)
+	loadPaths := sessionLoadPaths(sh, sessionKey, currentDir)
+
+	logger := shared.NewLogger(cmd.ErrOrStderr())
+
+	// skip regeneration when the load paths and their stamps are the same as the last run for this session
+	var keyFilepath string
+	var reuseLayers bool
+	var refresh bool
+	var previous *shared.SessionState
+	key := shared.LoadPathsKey(loadPaths)
+
+	if len(sessionKey) > 0 {
+		// gen can run concurrently in a session (e.g. from async prompt plugins), so runs take turns writing the
+		// session files; a run that waited usually finds them up to date and returns straight away below
+		lock, err := shared.LockSession(sessionKey, shell.Timeout()+lockTimeoutMargin)
+		if errors.Is(err, shared.ErrSessionLocked) {
+			return fmt.Errorf("%w, gave up waiting for it to finish", err)
+		}
+		if err != nil {
+			return err
+		}
+		defer lock.Unlock()
+
+		// remember which load paths were checked last (even when evaluating them fails below) so the prompt
+		// hook doesn't retry a broken or hanging file on every prompt
+		err = writeKey(key, shared.SessionFilepath(sessionKey, "checked"))
+		if err != nil {
+			return err
+		}
+
+		keyFilepath = shared.SessionFilepath(sessionKey, "key")
+
+		cachedKey, err := os.ReadFile(keyFilepath)
+		if err == nil && string(cachedKey) == key {
+			logger.Debug("load paths unchanged since the last gen")
+			return nil
+		}
+
+		// the layers loaded last are only built upon while there is a key saying they are loaded: reload, reset
+		// and new sessions remove it so everything is undone and loaded again
+		reuseLayers = err == nil
+
+		// envy reload asks for the files to be evaluated again rather than served from the daemon's cache
+		refresh = shared.Exists(shared.SessionFilepath(sessionKey, "reload"))
+
+		previous, _ = shared.LoadSessionState(sessionKey)
+	}
+
+	var note string
+	if loadDir != currentDir {
+		note = fmt.Sprintf("using %s (pinned by envy use)", loadDir)
+	}
+
+	_, err = transition(cmd, sh, sessionKey, previous, reuseLayers, refresh, loadDir, loadPaths, note)
+	if err != nil {
+		return err
+	}
+
+	if refresh {
+		err = os.Remove(shared.SessionFilepath(sessionKey, "reload"))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	// only remember the key once everything has been written successfully
+	if len(keyFilepath) > 0 {
+		return writeKey(key, keyFilepath)
+	}
+
+	return nil
+}
+
+// transition moves the session from the layers previous loaded (or from nothing unless reuseLayers) to the ones
+// of loadPaths evaluated in loadDir: the layers both share are kept, the others are undone and the new ones
+// evaluated (bypassing the daemon's cache when refresh is set), then the scripts for the hooks and the state are written and a summary (preceded by note) is
+// logged; it returns whether the session files were written, which is also the case when only some files were
+// loaded with ENVY_ON_ERROR=partial and the evaluation error is returned
+func transition(cmd *cobra.Command, sh shell.Shell, sessionKey string, previous *shared.SessionState, reuseLayers bool, refresh bool, loadDir string, loadPaths []string, note string) (bool, error) {
+	logger := shared.NewLogger(cmd.ErrOrStderr())
+
+	var loaded []shared.Layer
+	if previous != nil {
+		loaded = previous.LoadedLayers()
+	}
+
+	layers := shared.NewLayers(loadPaths)
+
+	kept := 0
+	if reuseLayers {
+		kept = shared.CommonLayers(loaded, layers)
+	}
+
+	popped := loaded[kept:]
+
+	// undo the layers that no longer apply in-process so the new ones are evaluated on top of the env the shell
+	// will have once it has sourced the undo script
+	environ := os.Environ()
+	baseEnviron := environ
+	for i := len(popped) - 1; i >= 0; i-- {
+		baseEnviron = shared.RevertEnviron(baseEnviron, popped[i].Changes)
+	}
+
+	// the env without any layer, which the files are sourced on top of
+	base := baseEnviron
+	for i := kept - 1; i >= 0; i-- {
+		base = shared.RevertEnviron(base, loaded[i].Changes)
+	}
+
+	// evaluate the layers entered one after the other (sh specific); this happens before anything is written
+	// so a failed, timed out or interrupted evaluation leaves the previous environment loaded
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ctx = context.WithValue(ctx, "refresh", refresh)
+
+	pushed, newEnviron, evalErr := evalLayers(ctx, sh, layers, kept, loadDir, base, baseEnviron, cmd.ErrOrStderr())
+	if evalErr != nil {
+		if onErrorPolicy() != "partial" || errors.Is(evalErr, context.Canceled) {
+			return false, evalErr
+		}
+
+		var err error
+
+		below := layers[:kept+len(pushed)]
+
+		pushed, newEnviron, err = genPartial(ctx, cmd, sh, below, layers[len(below)], loadDir, base, pushed, newEnviron, evalErr)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	stack := slices.Concat(loaded[:kept], pushed)
+
+	state := &shared.SessionState{
+		Version:   shared.SessionStateVersion,
+		Dir:       loadDir,
+		Layers:    stack,
+		Baseline:  shared.NewEnv(baseEnviron).Vars(),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	for _, layer := range stack {
+		state.LoadPaths = append(state.LoadPaths, layer.LoadPaths...)
+		state.Changes = shared.ComposeChanges(state.Changes, layer.Changes)
+	}
+
+	if previous != nil {
+		state.Parent = previous.Parent
+		state.CreatedAt = previous.CreatedAt
+		state.History = previous.History
+
+		if previous.Baseline != nil {
+			state.Baseline = previous.Baseline
+		}
+	}
+
+	err := writeSession(sh, sessionKey, state, popped, pushed)
+	if err != nil {
+		return false, err
+	}
+
+	if len(popped) > 0 {
+		logger.Info("unloading")
+	}
+
+	if len(note) > 0 && len(pushed) > 0 {
+		logger.Info("%s", note)
+	}
+
+	var pushedPaths []string
+	for _, layer := range pushed {
+		pushedPaths = append(pushedPaths, layer.Paths()...)
+	}
+
+	logger.Loading(pushedPaths)
+	logger.Changes(shared.NewEnv(environ).Diff(shared.NewEnv(newEnviron)))
+
+	if evalErr != nil {
+		fmt.Fprintf(cmd.ErrOrStderr(), "envy: partially loaded %d of %d files, skipped %s and the files after it\n", len(state.LoadPaths), len(loadPaths), shell.FailedPath(evalErr))
+		return true, evalErr
+	}
+
+	return true, nil
+
+}
 
-	// gen load script (sh specific)
-	loadLines, loadFilepath := sh.GenLoadFile(loadPaths)
-	err := writeLines(loadLines, loadFilepath)
+// evalLayers evaluates layers[kept:] one after the other, recording the changes each one makes on top of environ,
+// and returns the layers evaluated along with the resulting env until one of them fails; each layer is sourced
+// along with the layers below it on top of base (the env without any of them) since, like in the shell, the files
+// of a directory may use what the ones below define without exporting it. What the envy files print is only
+// written to stderr when they fail since the load script prints it when it is sourced
+func evalLayers(ctx context.Context, sh shell.Shell, layers []shared.Layer, kept int, dir string, base []string, environ []string, stderr io.Writer) ([]shared.Layer, []string, error) {
+	var evaluated []shared.Layer
+	var paths []string
+
+	for _, layer := range layers[:kept] {
+		paths = append(paths, layer.Paths()...)
+	}
+
+	below := shared.NewEnv(base)
+
+	if len(paths) > 0 {
+		var messages bytes.Buffer
+
+		env, err := resolveEnv(ctx, sh, paths, dir, base, &messages)
+		if err != nil {
+			stderr.Write(messages.Bytes())
+			return nil, environ, err
+		}
+
+		below = env
+	}
+
+	for _, layer := range layers[kept:] {
+		var messages bytes.Buffer
+
+		paths = append(paths, layer.Paths()...)
+
+		env, err := resolveEnv(ctx, sh, paths, dir, base, &messages)
+		if err != nil {
+			stderr.Write(messages.Bytes())
+			return evaluated, environ, err
+		}
+
+		// the layer only loads what its files change on top of the layers below, from the values the shell has;
+		// the files are evaluated in dir (e.g. pinned by envy use or returned to by envy back) whereas the shell
+		// stays where it is, so what the shell maintains itself isn't part of what the layer loads either
+		changed := below.Diff(env)
+
+		layer.Changes = slices.DeleteFunc(shared.NewEnv(environ).Diff(env), func(change shared.EnvChange) bool {
+			return slices.Contains(shared.ShellEnvVars, change.Key) || !slices.ContainsFunc(changed, func(c shared.EnvChange) bool {
+				return c.Key == change.Key
+			})
+		})
+		environ = shared.ApplyEnviron(environ, layer.Changes)
+		below = env
+
+		evaluated = append(evaluated, layer)
+	}
+
+	return evaluated, environ, nil
+}
+
+// sessionLoadPaths returns the load paths for dir, or for the directory pinned by envy use (sh specific), and
+// none while loading is suspended in the session
+func sessionLoadPaths(sh shell.Shell, sessionKey string, dir string) []string {
+	if isSuspended(sessionKey) {
+		return nil
+	}
+
+	return sh.FindLoadPaths(sessionDir(sessionKey, dir), sessionProfile(sessionKey))
+}
+
+// onErrorPolicy returns what gen does when evaluating the load paths fails: "keep" (the default) leaves the
+// previous environment loaded while "partial" loads the files before the failing one
+func onErrorPolicy() string {
+	policy := os.Getenv("ENVY_ON_ERROR")
+	if !slices.Contains(onErrorPolicies, policy) {
+		return onErrorPolicies[0]
+	}
+
+	return policy
+}
+
+// genPartial adds the files of the failed layer before the one that made evaluating it fail to the layers
+// evaluated so the shell ends up with a consistent (if partial) env; an error is returned when that isn't
+// possible, in which case the previous environment stays loaded
+func genPartial(ctx context.Context, cmd *cobra.Command, sh shell.Shell, below []shared.Layer, failed shared.Layer, dir string, base []string, pushed []shared.Layer, environ []string, evalErr error) ([]shared.Layer, []string, error) {
+	index := slices.Index(failed.Paths(), shell.FailedPath(evalErr))
+	if index < 0 {
+		fmt.Fprintln(cmd.ErrOrStderr(), "envy: could not tell which file failed, keeping the previous environment")
+		return nil, nil, evalErr
+	}
+
+	if index == 0 {
+		return pushed, environ, nil
+	}
+
+	failed.LoadPaths = failed.LoadPaths[:index]
+
+	evaluated, environ, err := evalLayers(ctx, sh, append(slices.Clone(below), failed), len(below), dir, base, environ, io.Discard)
+	if err != nil {
+		fmt.Fprintln(cmd.ErrOrStderr(), "envy: could not load the files before the failing one, keeping the previous environment")
+		return nil, nil, evalErr
+	}
+
+	return append(pushed, evaluated...), environ, nil
+}
+
+// writeSession renders the undo script for the layers popped and the load script for the layers pushed (sh
+// specific), which the shell hooks source once gen returns, then records the state of the session; the state
+// is written last so it never describes scripts that failed to be written
+func writeSession(sh shell.Shell, sessionKey string, state *shared.SessionState, popped []shared.Layer, pushed []shared.Layer) error {
+	state.UpdatedAt = time.Now().UTC()
+	state.AddTransition()
+
+	var poppedChanges [][]shared.EnvChange
+	for _, layer := range popped {
+		poppedChanges = append(poppedChanges, layer.Changes)
+	}
+
+	var pushedPaths []string
+	for _, layer := range pushed {
+		pushedPaths = append(pushedPaths, layer.Paths()...)
+	}
+
+	undoLines, undoFilepath := sh.GenUndoFile(shared.ComposeChanges(poppedChanges...))
+
+	err := writeLines(undoLines, undoFilepath)
 	if err != nil {
 		return err
 	}
 
-	// launch subshell to execute load paths and export env (sh specific)
-	subshell := sh.GetSubshellCmd()
-	output, err := subshell.CombinedOutput()
+	loadLines, loadFilepath := sh.GenLoadFile(pushedPaths)
+
+	err = writeLines(loadLines, loadFilepath)
 	if err != nil {
 		return err
 	}
 
-	newEnv := shared.NewEnv(strings.Split(string(output), "\n"))
+	if len(sessionKey) == 0 {
+		return nil
+	}
 
-	// compare envs
-	changes := oldEnv.Diff(newEnv)
+	return state.Save(sessionKey)
+}
 
-	// gen unload script (sh specific)
-	undoLines, undoFilepath := sh.GenUndoFile(changes)
-	err = writeLines(undoLines, undoFilepath)
+func writeKey(key string, name string) error {
+	err := os.MkdirAll(filepath.Dir(name), 0755)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return writeLines([]string{key}, name)
 }
 
+// resolveEnv asks the daemon (when one is running) to evaluate the load paths on top of environ, skipping its
+// cache when "refresh" is set in ctx, and falls back to evaluating them in-process
+func resolveEnv(ctx context.Context, sh shell.Shell, paths []string, dir string, environ []string, stderr io.Writer) (*shared.Env, error) {
+	timeout := shell.Timeout()
+	refresh, _ := ctx.Value("refresh").(bool)
+
+	request := daemon.Request{Shell: os.Getenv("ENVY_SHELL"), Dir: dir, Environ: environ, Paths: paths, Timeout: timeout, Refresh: refresh}
+
+	lines, err := daemon.Eval(ctx, daemon.SocketPath(), request)
+	if err == nil {
+		return shared.NewEnv(lines), nil
+	}
+
+	if !errors.Is(err, daemon.ErrUnavailable) {
+		return nil, err
+	}
+
+	return evalEnv(ctx, sh, paths, dir, environ, timeout, stderr)
+}
+
+// evalEnv sources the load paths on top of environ in a subshell started in dir and returns the
+// resulting env; the subshell is killed when it takes longer than timeout or ctx is cancelled and anything
+// the envy files print is written to stderr
+func evalEnv(ctx context.Context, sh shell.Shell, paths []string, dir string, environ []string, timeout time.Duration, stderr io.Writer) (*shared.Env, error) {
+	// files that stick to simple exports and assignments are evaluated in-process to avoid the cost of a
+	// subshell; anything else (or any error) falls back to the real shell
+	lines, err := posix.Eval(paths, environ, dir)
+	if err == nil {
+		return shared.NewEnv(lines), nil
+	}
+
+	subshell := sh.GetSubshellCmd(paths)
+	subshell.Dir = dir
+	subshell.Env = environ
+
+	output, err := shell.Run(ctx, subshell, timeout, stderr)
+	if err != nil {
+		return nil, err
+	}
+
+	return shared.NewEnv(strings.Split(string(output), "\n")), nil
+}
+
+// writeLines replaces name atomically (by writing to a temp file in the same dir and renaming it) so the
+// shell never sources a half-written script
 func writeLines(lines []string, name string) error {
 	content := strings.Join(lines, "\n")
 
-	return os.WriteFile(name, []byte(content), 0644)
+	file, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.WriteString(content)
+	if err == nil {
+		err = file.Chmod(0644)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), name)
 }
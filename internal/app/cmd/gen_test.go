@@ -1,34 +1,50 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
 	"envy/internal/app/shared"
 	"envy/internal/app/shell"
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 )
 
 type fakeShell struct {
-	findLoadPaths  func() []string
-	getSubshellCmd func() *exec.Cmd
+	findLoadPaths  func(dir string) []string
+	findProfiles   func(dir string) []string
+	getSubshellCmd func(paths []string) *exec.Cmd
 	genLoadFile    func(paths []string) ([]string, string)
 	genUndoFile    func(changes []shared.EnvChange) ([]string, string)
+
+	// profile is the one the load paths were last looked up for
+	profile string
 }
 
 func (f *fakeShell) Init(_ io.Writer) error {
 	return nil
 }
 
-func (f *fakeShell) FindLoadPaths() []string {
-	return f.findLoadPaths()
+func (f *fakeShell) FindLoadPaths(dir string, profile string) []string {
+	f.profile = profile
+	return f.findLoadPaths(dir)
+}
+
+func (f *fakeShell) FindProfiles(dir string) []string {
+	return f.findProfiles(dir)
 }
 
-func (f *fakeShell) GetSubshellCmd() *exec.Cmd {
-	return f.getSubshellCmd()
+func (f *fakeShell) GetSubshellCmd(paths []string) *exec.Cmd {
+	return f.getSubshellCmd(paths)
 }
 
 func (f *fakeShell) GenLoadFile(paths []string) ([]string, string) {
@@ -62,6 +78,7 @@ func TestGenCmd(t *testing.T) {
 			// using the test shell
 			t.Setenv("ENVY_SHELL", "test")
 			t.Setenv("ENVY_SESSION_KEY", "12345678")
+			t.Setenv("HOME", t.TempDir())
 
 			rootCmd.SetArgs(tt.args)
 			rootCmd.SetOut(io.Discard)
@@ -140,8 +157,8 @@ func TestGenRun(t *testing.T) {
 		{
 			name: "success",
 			fake: &fakeShell{
-				findLoadPaths:  func() []string { return []string{} },
-				getSubshellCmd: func() *exec.Cmd { return exec.Command("sh", "-c", "exit 0") }, // echo full env so diff is empty
+				findLoadPaths:  func(_ string) []string { return []string{} },
+				getSubshellCmd: func(_ []string) *exec.Cmd { return exec.Command("sh", "-c", "exit 0") }, // echo full env so diff is empty
 				genLoadFile: func(paths []string) ([]string, string) {
 					return []string{}, filepath.Join(tmp, "session.load.sh")
 				},
@@ -163,8 +180,8 @@ func TestGenRun(t *testing.T) {
 		{
 			name: "error in writeLines due to sh.GenLoadFile",
 			fake: &fakeShell{
-				findLoadPaths:  func() []string { return []string{} },
-				getSubshellCmd: func() *exec.Cmd { return exec.Command("sh", "-c", "exit 0") }, // echo full env so diff is empty
+				findLoadPaths:  func(_ string) []string { return []string{} },
+				getSubshellCmd: func(_ []string) *exec.Cmd { return exec.Command("sh", "-c", "exit 0") }, // echo full env so diff is empty
 				genLoadFile: func(paths []string) ([]string, string) {
 					return []string{}, ""
 				},
@@ -177,8 +194,8 @@ func TestGenRun(t *testing.T) {
 		{
 			name: "error subshell.CombinedOutput",
 			fake: &fakeShell{
-				findLoadPaths:  func() []string { return []string{} },
-				getSubshellCmd: func() *exec.Cmd { return exec.Command("sh", "-c", "exit 1") }, // echo full env so diff is empty
+				findLoadPaths:  func(_ string) []string { return []string{filepath.Join(tmp, "envy.sh")} },
+				getSubshellCmd: func(_ []string) *exec.Cmd { return exec.Command("sh", "-c", "exit 1") }, // echo full env so diff is empty
 				genLoadFile: func(paths []string) ([]string, string) {
 					return []string{}, filepath.Join(tmp, "session.load.sh")
 				},
@@ -191,8 +208,8 @@ func TestGenRun(t *testing.T) {
 		{
 			name: "error in writeLines due to sh.GenUndoFile",
 			fake: &fakeShell{
-				findLoadPaths:  func() []string { return []string{} },
-				getSubshellCmd: func() *exec.Cmd { return exec.Command("sh", "-c", "exit 0") }, // echo full env so diff is empty
+				findLoadPaths:  func(_ string) []string { return []string{} },
+				getSubshellCmd: func(_ []string) *exec.Cmd { return exec.Command("sh", "-c", "exit 0") }, // echo full env so diff is empty
 				genLoadFile: func(paths []string) ([]string, string) {
 					return []string{}, filepath.Join(tmp, "session.load.sh")
 				},
@@ -206,8 +223,7 @@ func TestGenRun(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			ctx := genCmd.Context()
-			ctx = context.WithValue(ctx, "shell", tt.fake)
+			ctx := context.WithValue(context.Background(), "shell", tt.fake)
 			genCmd.SetContext(ctx)
 
 			err := genRun(genCmd)
@@ -221,6 +237,592 @@ func TestGenRun(t *testing.T) {
 	}
 }
 
+func TestGenRun_Cache(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+
+	envyFilepath := filepath.Join(tmp, "envy.sh")
+	// use a command so the file can't be evaluated in-process
+	if err := os.WriteFile(envyFilepath, []byte("echo loading"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	subshellCalls := 0
+
+	fake := &fakeShell{
+		findLoadPaths: func(_ string) []string { return []string{envyFilepath} },
+		getSubshellCmd: func(_ []string) *exec.Cmd {
+			subshellCalls++
+			return exec.Command("sh", "-c", "exit 0")
+		},
+		genLoadFile: func(paths []string) ([]string, string) {
+			return []string{}, filepath.Join(tmp, "session.load.sh")
+		},
+		genUndoFile: func(_ []shared.EnvChange) ([]string, string) {
+			return []string{}, filepath.Join(tmp, "session.undo.sh")
+		},
+	}
+
+	ctx := context.WithValue(context.Background(), "shell", fake)
+	ctx = context.WithValue(ctx, "sessionKey", "12345678")
+	genCmd.SetContext(ctx)
+
+	var stderr bytes.Buffer
+	genCmd.SetErr(&stderr)
+	defer genCmd.SetErr(nil)
+
+	// the first run has no cached key and must evaluate the load paths
+	if err := genRun(genCmd); err != nil {
+		t.Fatalf("genRun() unexpected error: %v", err)
+	}
+
+	if want := "envy: loading ~/envy.sh\n"; !strings.HasPrefix(stderr.String(), want) {
+		t.Errorf("expected the summary to start with %q, got %q", want, stderr.String())
+	}
+
+	// what was loaded is recorded in the session state
+	state, err := shared.LoadSessionState("12345678")
+	if err != nil {
+		t.Fatalf("LoadSessionState() unexpected error: %v", err)
+	}
+
+	if len(state.LoadPaths) != 1 || state.LoadPaths[0].Path != envyFilepath || state.LoadPaths[0].Hash != shared.HashFile(envyFilepath) {
+		t.Errorf("expected the session state to record %s and its hash, got %+v", envyFilepath, state.LoadPaths)
+	}
+
+	stderr.Reset()
+
+	// the second run has a matching key and must return before launching a subshell
+	if err := genRun(genCmd); err != nil {
+		t.Fatalf("genRun() unexpected error: %v", err)
+	}
+
+	if subshellCalls != 1 {
+		t.Errorf("expected 1 subshell call after an unchanged rerun, got %d", subshellCalls)
+	}
+
+	if stderr.Len() > 0 {
+		t.Errorf("expected no summary after an unchanged rerun, got %q", stderr.String())
+	}
+
+	// editing the file changes the key so the third run must evaluate again
+	if err := os.WriteFile(envyFilepath, []byte("echo reloading"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := genRun(genCmd); err != nil {
+		t.Fatalf("genRun() unexpected error: %v", err)
+	}
+
+	if subshellCalls != 2 {
+		t.Errorf("expected 2 subshell calls after editing a load path, got %d", subshellCalls)
+	}
+
+	reloaded, err := shared.LoadSessionState("12345678")
+	if err != nil {
+		t.Fatalf("LoadSessionState() unexpected error: %v", err)
+	}
+
+	if !reloaded.CreatedAt.Equal(state.CreatedAt) || reloaded.LoadPaths[0].Hash == state.LoadPaths[0].Hash {
+		t.Errorf("expected the session state to keep its creation time and record the new hash, got %+v", reloaded)
+	}
+
+	if len(reloaded.History) != 2 {
+		t.Errorf("expected a transition in the history for each load, got %+v", reloaded.History)
+	}
+}
+
+func TestGenRun_Layers(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("ENVY_STATELESS", "")
+
+	rootDir := filepath.Join(tmp, "root")
+	projectDir := filepath.Join(rootDir, "project")
+	os.MkdirAll(projectDir, 0755)
+	os.WriteFile(filepath.Join(rootDir, "envy.sh"), []byte("export ENVY_LAYER_ROOT=1"), 0644)
+	os.WriteFile(filepath.Join(projectDir, "envy.sh"), []byte("export ENVY_LAYER_PROJECT=1"), 0644)
+
+	var loaded []string
+	var undone []shared.EnvChange
+
+	fake := &fakeShell{
+		findLoadPaths: func(dir string) []string { return shared.FindLoadPaths(dir, "envy.sh", "") },
+		genLoadFile: func(paths []string) ([]string, string) {
+			loaded = paths
+			return []string{}, filepath.Join(tmp, "session.load.sh")
+		},
+		genUndoFile: func(changes []shared.EnvChange) ([]string, string) {
+			undone = changes
+			return []string{}, filepath.Join(tmp, "session.undo.sh")
+		},
+	}
+
+	ctx := context.WithValue(context.Background(), "shell", fake)
+	ctx = context.WithValue(ctx, "sessionKey", "12345678")
+	genCmd.SetContext(ctx)
+	genCmd.SetErr(io.Discard)
+	defer genCmd.SetErr(nil)
+
+	tests := []struct {
+		name       string
+		dir        string
+		wantLoaded []string
+		wantUndone []shared.EnvChange
+	}{
+		{
+			name:       "enter the root",
+			dir:        rootDir,
+			wantLoaded: []string{filepath.Join(rootDir, "envy.sh")},
+		},
+		{
+			name:       "descend only loads the new layer",
+			dir:        projectDir,
+			wantLoaded: []string{filepath.Join(projectDir, "envy.sh")},
+		},
+		{
+			name:       "ascend only undoes the popped layer",
+			dir:        rootDir,
+			wantUndone: []shared.EnvChange{{Key: "ENVY_LAYER_PROJECT", NewValue: "1"}},
+		},
+		{
+			name:       "leave undoes everything",
+			dir:        tmp,
+			wantUndone: []shared.EnvChange{{Key: "ENVY_LAYER_ROOT", NewValue: "1"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(tt.dir)
+
+			if err := genRun(genCmd); err != nil {
+				t.Fatalf("genRun() unexpected error: %v", err)
+			}
+
+			if !slices.Equal(loaded, tt.wantLoaded) {
+				t.Errorf("genRun() loaded %v, want %v", loaded, tt.wantLoaded)
+			}
+
+			if !slices.Equal(undone, tt.wantUndone) {
+				t.Errorf("genRun() undid %+v, want %+v", undone, tt.wantUndone)
+			}
+		})
+	}
+}
+
+func TestGenRun_LayersUnexported(t *testing.T) {
+	tests := []struct {
+		name    string
+		project string
+		descend bool
+	}{
+		{
+			name:    "full load",
+			project: "export ENVY_LAYER_BIN=$ENVY_LAYER_BASE/bin",
+		},
+		{
+			name:    "descend",
+			project: "export ENVY_LAYER_BIN=$ENVY_LAYER_BASE/bin",
+			descend: true,
+		},
+		{
+			name:    "descend in a subshell",
+			project: "export ENVY_LAYER_BIN=$(echo $ENVY_LAYER_BASE)/bin",
+			descend: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			t.Setenv("HOME", tmp)
+			t.Setenv("ENVY_STATELESS", "")
+
+			// the root defines a plain variable the project uses without it being exported
+			rootDir := filepath.Join(tmp, "root")
+			projectDir := filepath.Join(rootDir, "project")
+			os.MkdirAll(projectDir, 0755)
+			os.WriteFile(filepath.Join(rootDir, "envy.sh"), []byte("ENVY_LAYER_BASE=/opt/x"), 0644)
+			os.WriteFile(filepath.Join(projectDir, "envy.sh"), []byte(tt.project), 0644)
+
+			fake := &fakeShell{
+				findLoadPaths: func(dir string) []string { return shared.FindLoadPaths(dir, "envy.sh", "") },
+				getSubshellCmd: func(paths []string) *exec.Cmd {
+					var script string
+					for _, path := range paths {
+						script += fmt.Sprintf(". %s; ", path)
+					}
+					return exec.Command("sh", "-c", script+"env")
+				},
+				genLoadFile: func(paths []string) ([]string, string) {
+					return []string{}, filepath.Join(tmp, "session.load.sh")
+				},
+				genUndoFile: func(_ []shared.EnvChange) ([]string, string) {
+					return []string{}, filepath.Join(tmp, "session.undo.sh")
+				},
+			}
+
+			ctx := context.WithValue(context.Background(), "shell", fake)
+			ctx = context.WithValue(ctx, "sessionKey", "12345678")
+			genCmd.SetContext(ctx)
+			genCmd.SetErr(io.Discard)
+			defer genCmd.SetErr(nil)
+
+			if tt.descend {
+				t.Chdir(rootDir)
+
+				if err := genRun(genCmd); err != nil {
+					t.Fatalf("genRun() unexpected error: %v", err)
+				}
+			}
+
+			t.Chdir(projectDir)
+
+			if err := genRun(genCmd); err != nil {
+				t.Fatalf("genRun() unexpected error: %v", err)
+			}
+
+			state, err := shared.LoadSessionState("12345678")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := []shared.EnvChange{{Key: "ENVY_LAYER_BIN", NewValue: "/opt/x/bin"}}
+			if !slices.Equal(state.Changes, want) {
+				t.Errorf("genRun() recorded %+v, want %+v", state.Changes, want)
+			}
+		})
+	}
+}
+
+func TestGenRun_Timeout(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("ENVY_TIMEOUT", "100ms")
+
+	envyFilepath := filepath.Join(tmp, "envy.sh")
+	if err := os.WriteFile(envyFilepath, []byte("sleep 10"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loadFilepath := filepath.Join(tmp, "session.load.sh")
+	undoFilepath := filepath.Join(tmp, "session.undo.sh")
+
+	// scripts left behind by the previous directory
+	for _, name := range []string{loadFilepath, undoFilepath} {
+		if err := os.WriteFile(name, []byte("previous"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fake := &fakeShell{
+		findLoadPaths: func(_ string) []string { return []string{envyFilepath} },
+		getSubshellCmd: func(paths []string) *exec.Cmd {
+			return exec.Command("sh", "-c", fmt.Sprintf("echo %s >&3; sleep 10", paths[0]))
+		},
+		genLoadFile: func(paths []string) ([]string, string) {
+			return []string{"next"}, loadFilepath
+		},
+		genUndoFile: func(_ []shared.EnvChange) ([]string, string) {
+			return []string{"next"}, undoFilepath
+		},
+	}
+
+	ctx := context.WithValue(context.Background(), "shell", fake)
+	ctx = context.WithValue(ctx, "sessionKey", "12345678")
+	genCmd.SetContext(ctx)
+
+	err := genRun(genCmd)
+
+	var timeoutErr *shell.TimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("genRun() error = %v, want a timeout error", err)
+	}
+
+	if timeoutErr.Path != envyFilepath {
+		t.Errorf("expected the timeout to name %s, got %s", envyFilepath, timeoutErr.Path)
+	}
+
+	// nothing is written so the previous environment stays loaded
+	for _, name := range []string{loadFilepath, undoFilepath} {
+		content, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(content) != "previous" {
+			t.Errorf("expected %s to be left untouched, got %q", name, content)
+		}
+	}
+
+	if shared.Exists(shared.SessionFilepath("12345678", "key")) {
+		t.Error("expected no key to be written after a timeout")
+	}
+
+	// but the paths count as checked so the prompt hook doesn't retry them until they change
+	if !shared.Exists(shared.SessionFilepath("12345678", "checked")) {
+		t.Error("expected the checked key to be written after a timeout")
+	}
+}
+
+func TestGenRun_Locked(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("session locks are only taken on unix")
+	}
+
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("ENVY_TIMEOUT", "50ms")
+
+	lockTimeoutMargin = 0
+	defer func() { lockTimeoutMargin = 5 * time.Second }()
+
+	fake := &fakeShell{
+		findLoadPaths: func(_ string) []string { return nil },
+		genLoadFile: func(paths []string) ([]string, string) {
+			return []string{}, filepath.Join(tmp, "session.load.sh")
+		},
+		genUndoFile: func(_ []shared.EnvChange) ([]string, string) {
+			return []string{}, filepath.Join(tmp, "session.undo.sh")
+		},
+	}
+
+	ctx := context.WithValue(context.Background(), "shell", fake)
+	ctx = context.WithValue(ctx, "sessionKey", "12345678")
+	genCmd.SetContext(ctx)
+	genCmd.SetErr(io.Discard)
+	defer genCmd.SetErr(nil)
+
+	// another run holding the lock for longer than gen waits
+	lock, err := shared.LockSession("12345678", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := genRun(genCmd); !errors.Is(err, shared.ErrSessionLocked) {
+		t.Fatalf("genRun() error = %v, want ErrSessionLocked", err)
+	}
+
+	if shared.Exists(shared.SessionFilepath("12345678", "checked")) {
+		t.Error("expected nothing to be written while the session is locked")
+	}
+
+	lock.Unlock()
+
+	if err := genRun(genCmd); err != nil {
+		t.Fatalf("genRun() unexpected error once the lock was released: %v", err)
+	}
+}
+
+func TestGenRun_Failure(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+
+	envyFilepath := filepath.Join(tmp, "envy.sh")
+	if err := os.WriteFile(envyFilepath, []byte("echo warning >&2; foo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &fakeShell{
+		findLoadPaths: func(_ string) []string { return []string{envyFilepath} },
+		getSubshellCmd: func(paths []string) *exec.Cmd {
+			return exec.Command("sh", "-c", fmt.Sprintf("echo %[1]s >&3; echo warning >&2; echo '%[1]s:1: command not found: foo' >&2; exit 1", paths[0]))
+		},
+		genLoadFile: func(paths []string) ([]string, string) {
+			return []string{}, filepath.Join(tmp, "session.load.sh")
+		},
+		genUndoFile: func(_ []shared.EnvChange) ([]string, string) {
+			return []string{}, filepath.Join(tmp, "session.undo.sh")
+		},
+	}
+
+	ctx := context.WithValue(context.Background(), "shell", fake)
+	ctx = context.WithValue(ctx, "sessionKey", "12345678")
+	genCmd.SetContext(ctx)
+
+	var stderr bytes.Buffer
+	genCmd.SetErr(&stderr)
+	defer genCmd.SetErr(nil)
+
+	err := genRun(genCmd)
+
+	var evalErr *shell.EvalError
+	if !errors.As(err, &evalErr) {
+		t.Fatalf("genRun() error = %v, want an eval error", err)
+	}
+
+	if evalErr.Path != envyFilepath || evalErr.Line != 1 || evalErr.Message != "command not found: foo" {
+		t.Errorf("genRun() error = %#v, want %s line 1", evalErr, envyFilepath)
+	}
+
+	// the messages from the failed evaluation are passed on since the load script won't print them
+	if !strings.Contains(stderr.String(), "warning") {
+		t.Errorf("expected the messages from envy files on stderr, got %q", stderr.String())
+	}
+}
+
+func TestGenRun_Partial(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+
+	parentFilepath := filepath.Join(tmp, "envy.sh")
+	childFilepath := filepath.Join(tmp, "child", "envy.sh")
+
+	// use commands so the files can't be evaluated in-process
+	os.MkdirAll(filepath.Dir(childFilepath), 0755)
+	for _, name := range []string{parentFilepath, childFilepath} {
+		if err := os.WriteFile(name, []byte("echo loading"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	loadFilepath := filepath.Join(tmp, "session.load.sh")
+	undoFilepath := filepath.Join(tmp, "session.undo.sh")
+
+	fake := &fakeShell{
+		findLoadPaths: func(_ string) []string { return []string{parentFilepath, childFilepath} },
+		getSubshellCmd: func(paths []string) *exec.Cmd {
+			// each directory is evaluated along with the ones below it, the child one fails
+			if slices.Contains(paths, childFilepath) {
+				return exec.Command("sh", "-c", fmt.Sprintf("echo %s >&3; exit 1", childFilepath))
+			}
+			return exec.Command("sh", "-c", "export ENVY_PARTIAL_TEST=parent; env")
+		},
+		genLoadFile: func(paths []string) ([]string, string) {
+			return paths, loadFilepath
+		},
+		genUndoFile: func(changes []shared.EnvChange) ([]string, string) {
+			var lines []string
+			for _, change := range changes {
+				lines = append(lines, change.Key)
+			}
+			return lines, undoFilepath
+		},
+	}
+
+	ctx := context.WithValue(context.Background(), "shell", fake)
+	ctx = context.WithValue(ctx, "sessionKey", "12345678")
+	genCmd.SetContext(ctx)
+
+	var stderr bytes.Buffer
+	genCmd.SetErr(&stderr)
+	defer genCmd.SetErr(nil)
+
+	tests := []struct {
+		name     string
+		policy   string
+		wantLoad string
+		wantUndo string
+	}{
+		{
+			name:     "keep",
+			policy:   "keep",
+			wantLoad: "previous",
+			wantUndo: "previous",
+		},
+		{
+			name:     "invalid policy keeps",
+			policy:   "whatever",
+			wantLoad: "previous",
+			wantUndo: "previous",
+		},
+		{
+			name:     "partial",
+			policy:   "partial",
+			wantLoad: parentFilepath,
+			wantUndo: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ENVY_ON_ERROR", tt.policy)
+
+			for _, name := range []string{loadFilepath, undoFilepath} {
+				if err := os.WriteFile(name, []byte("previous"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var evalErr *shell.EvalError
+			if err := genRun(genCmd); !errors.As(err, &evalErr) || evalErr.Path != childFilepath {
+				t.Fatalf("genRun() error = %v, want an eval error for %s", err, childFilepath)
+			}
+
+			load, _ := os.ReadFile(loadFilepath)
+			if string(load) != tt.wantLoad {
+				t.Errorf("load script = %q, want %q", load, tt.wantLoad)
+			}
+
+			undo, _ := os.ReadFile(undoFilepath)
+			if string(undo) != tt.wantUndo {
+				t.Errorf("undo script = %q, want %q", undo, tt.wantUndo)
+			}
+		})
+	}
+}
+
+func TestEvalEnv(t *testing.T) {
+	tmp := t.TempDir()
+
+	simple := filepath.Join(tmp, "simple.sh")
+	if err := os.WriteFile(simple, []byte("export ENVY_EVAL_TEST=simple"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	complex := filepath.Join(tmp, "complex.sh")
+	if err := os.WriteFile(complex, []byte("export ENVY_EVAL_TEST=$(echo complex)"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		paths         []string
+		wantSubshell  bool
+		wantEvalValue string
+	}{
+		{
+			name:          "simple files are evaluated in-process",
+			paths:         []string{simple},
+			wantSubshell:  false,
+			wantEvalValue: "simple",
+		},
+		{
+			name:          "anything else falls back to the subshell",
+			paths:         []string{simple, complex},
+			wantSubshell:  true,
+			wantEvalValue: "subshell",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subshellCalled := false
+
+			fake := &fakeShell{
+				getSubshellCmd: func(_ []string) *exec.Cmd {
+					subshellCalled = true
+					return exec.Command("echo", "ENVY_EVAL_TEST=subshell")
+				},
+			}
+
+			env, err := evalEnv(context.Background(), fake, tt.paths, tmp, os.Environ(), shell.DefaultTimeout, io.Discard)
+			if err != nil {
+				t.Fatalf("evalEnv() unexpected error: %v", err)
+			}
+
+			if subshellCalled != tt.wantSubshell {
+				t.Errorf("evalEnv() subshell called = %v, want %v", subshellCalled, tt.wantSubshell)
+			}
+
+			if env.Vars()["ENVY_EVAL_TEST"] != tt.wantEvalValue {
+				t.Errorf("evalEnv() ENVY_EVAL_TEST = %q, want %q", env.Vars()["ENVY_EVAL_TEST"], tt.wantEvalValue)
+			}
+		})
+	}
+}
+
 func TestWriteLines(t *testing.T) {
 	tmp := t.TempDir()
 
@@ -250,4 +852,10 @@ func TestWriteLines(t *testing.T) {
 			}
 		})
 	}
+
+	// no temp files are left behind
+	entries, _ := os.ReadDir(tmp)
+	if len(entries) != 1 {
+		t.Errorf("expected only the written file in %s, got %d entries", tmp, len(entries))
+	}
 }
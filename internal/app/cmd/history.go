@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"envy/internal/app/shared"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List the environments loaded in the current session",
+	Long: fmt.Sprintf(`Lists the last %d environments loaded in the current session, oldest first, with when and where they
+were loaded from and how many variables they changed. envy back returns to the one before the last.`, shared.SessionHistoryLimit),
+	Args: cobra.NoArgs,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return genPreRun(cmd)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return historyRun(cmd, cmd.OutOrStdout())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+}
+
+func historyRun(cmd *cobra.Command, writer io.Writer) error {
+	sessionKey, _ := cmd.Context().Value("sessionKey").(string)
+
+	if len(os.Getenv("ENVY_STATELESS")) > 0 {
+		return errStateless
+	}
+
+	state, err := shared.LoadSessionState(sessionKey)
+	if err != nil && !errors.Is(err, shared.ErrNoSessionState) {
+		return err
+	}
+
+	if state == nil || len(state.History) == 0 {
+		fmt.Fprintln(writer, "nothing loaded in this session")
+		return nil
+	}
+
+	for _, transition := range state.History {
+		fmt.Fprintf(writer, "%s  %s  %d file(s), %d change(s)\n", transition.At.Local().Format("2006-01-02 15:04:05"), transition.Dir, len(transition.Paths), transition.Changes)
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"envy/internal/app/shared"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistoryRun(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("ENVY_STATELESS", "")
+
+	historyCmd.SetContext(context.WithValue(context.Background(), "sessionKey", "12345678"))
+
+	var buf bytes.Buffer
+
+	if err := historyRun(historyCmd, &buf); err != nil {
+		t.Fatalf("historyRun() unexpected error: %v", err)
+	}
+
+	if !strings.Contains(buf.String(), "nothing loaded") {
+		t.Errorf("historyRun() output = %q, want nothing loaded", buf.String())
+	}
+
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.Local)
+
+	state := &shared.SessionState{
+		Version: shared.SessionStateVersion,
+		History: []shared.Transition{
+			{At: at, Dir: "/projects/service", Paths: []string{"/envy.sh", "/projects/service/envy.sh"}, Changes: 3},
+			{At: at.Add(time.Minute), Dir: "/tmp", Changes: 0},
+		},
+	}
+	if err := state.Save("12345678"); err != nil {
+		t.Fatal(err)
+	}
+
+	buf.Reset()
+
+	if err := historyRun(historyCmd, &buf); err != nil {
+		t.Fatalf("historyRun() unexpected error: %v", err)
+	}
+
+	want := "2026-01-02 03:04:05  /projects/service  2 file(s), 3 change(s)\n2026-01-02 03:05:05  /tmp  0 file(s), 0 change(s)\n"
+	if buf.String() != want {
+		t.Errorf("historyRun() output = %q, want %q", buf.String(), want)
+	}
+}
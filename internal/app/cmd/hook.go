@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"bytes"
+	"envy/internal/app/shared"
+	"envy/internal/app/shell"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+)
+
+var hookCmd = &cobra.Command{
+	Use:   "hook",
+	Short: "Print the undo and load commands for the current directory",
+	Long: `Prints the commands that undo what was loaded before and load the envy.sh files for the current directory
+for the shell to eval. Unlike gen nothing is written to disk: what was loaded is carried in ENVY_STATE instead.
+This command is usually called by the shell hooks when ENVY_STATELESS is set.`,
+	Args: cobra.NoArgs,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return genPreRun(cmd)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return hookRun(cmd, cmd.OutOrStdout())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(hookCmd)
+}
+
+func hookRun(cmd *cobra.Command, writer io.Writer) error {
+	sh := cmd.Context().Value("shell").(shell.Shell)
+
+	state, err := shared.DecodeState(os.Getenv("ENVY_STATE"))
+	if err != nil {
+		return fmt.Errorf("could not decode ENVY_STATE (%v); unset it and start a new shell", err)
+	}
+
+	currentDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	loadPaths := sh.FindLoadPaths(currentDir, os.Getenv("ENVY_PROFILE"))
+	key := shared.LoadPathsKey(loadPaths)
+
+	// nothing to do when the same paths are loaded (or failed to load) already
+	if key == state.Key || key == state.Checked {
+		return nil
+	}
+
+	// undo what was loaded before in-process so the env the files are evaluated on top of matches what the
+	// shell will have once it has run the undo commands
+	baseEnviron := shared.RevertEnviron(os.Environ(), state.Changes)
+	oldEnv := shared.NewEnv(baseEnviron)
+
+	newEnv := oldEnv
+	if len(loadPaths) > 0 {
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		var messages bytes.Buffer
+
+		newEnv, err = resolveEnv(ctx, sh, loadPaths, currentDir, baseEnviron, &messages)
+		if err != nil {
+			cmd.ErrOrStderr().Write(messages.Bytes())
+
+			// keep the previous environment (nothing has been undone yet) but remember the paths were checked
+			// so they aren't retried on every prompt
+			state.Checked = key
+
+			encoded, encodeErr := shared.EncodeState(state)
+			if encodeErr == nil {
+				fmt.Fprintf(writer, "export ENVY_STATE=%s\n", encoded)
+			}
+
+			return err
+		}
+	}
+
+	changes := oldEnv.Diff(newEnv)
+
+	encoded, err := shared.EncodeState(shared.State{Key: key, Changes: changes})
+	if err != nil {
+		return err
+	}
+
+	undoLines, _ := sh.GenUndoFile(state.Changes)
+	loadLines, _ := sh.GenLoadFile(loadPaths)
+
+	err = writeScript(writer, undoLines, loadLines, []string{fmt.Sprintf("export ENVY_STATE=%s", encoded)})
+	if err != nil {
+		return err
+	}
+
+	logger := shared.NewLogger(cmd.ErrOrStderr())
+	if len(state.Key) > 0 && state.Key != shared.LoadPathsKey(nil) {
+		logger.Info("unloading")
+	}
+
+	logger.Loading(loadPaths)
+	logger.Changes(changes)
+
+	return nil
+}
+
+func writeScript(writer io.Writer, parts ...[]string) error {
+	for _, lines := range parts {
+		for _, line := range lines {
+			_, err := io.WriteString(writer, line+"\n")
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"envy/internal/app/shared"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHookRun(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("ENVY_STATE", "")
+	t.Setenv("ENVY_LOG", "quiet")
+
+	envyFilepath := filepath.Join(tmp, "envy.sh")
+	// use a command so the file can't be evaluated in-process
+	if err := os.WriteFile(envyFilepath, []byte("echo loading"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	failing := false
+
+	fake := &fakeShell{
+		findLoadPaths: func(_ string) []string { return []string{envyFilepath} },
+		getSubshellCmd: func(paths []string) *exec.Cmd {
+			if failing {
+				return exec.Command("sh", "-c", fmt.Sprintf("echo %s >&3; exit 1", paths[0]))
+			}
+			return exec.Command("sh", "-c", "export ENVY_HOOK_TEST=loaded; env")
+		},
+		genLoadFile: func(paths []string) ([]string, string) {
+			var lines []string
+			for _, path := range paths {
+				lines = append(lines, ". "+path)
+			}
+			return lines, ""
+		},
+		genUndoFile: func(changes []shared.EnvChange) ([]string, string) {
+			var lines []string
+			for _, change := range changes {
+				lines = append(lines, "unset "+change.Key)
+			}
+			return lines, ""
+		},
+	}
+
+	ctx := context.WithValue(context.Background(), "shell", fake)
+	ctx = context.WithValue(ctx, "sessionKey", "12345678")
+	hookCmd.SetContext(ctx)
+	hookCmd.SetErr(io.Discard)
+	defer hookCmd.SetErr(nil)
+
+	// the first run loads the file and carries the changes in ENVY_STATE
+	var buf bytes.Buffer
+
+	if err := hookRun(hookCmd, &buf); err != nil {
+		t.Fatalf("hookRun() unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || lines[0] != ". "+envyFilepath || !strings.HasPrefix(lines[1], "export ENVY_STATE=") {
+		t.Fatalf("hookRun() output = %q, want the load commands followed by ENVY_STATE", buf.String())
+	}
+
+	encoded := strings.TrimPrefix(lines[1], "export ENVY_STATE=")
+
+	state, err := shared.DecodeState(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(state.Changes) != 1 || state.Changes[0].Key != "ENVY_HOOK_TEST" {
+		t.Errorf("expected ENVY_STATE to carry the ENVY_HOOK_TEST change, got %+v", state.Changes)
+	}
+
+	// nothing is printed while the files are unchanged
+	t.Setenv("ENVY_STATE", encoded)
+	t.Setenv("ENVY_HOOK_TEST", "loaded")
+	buf.Reset()
+
+	if err := hookRun(hookCmd, &buf); err != nil {
+		t.Fatalf("hookRun() unexpected error: %v", err)
+	}
+
+	if buf.Len() > 0 {
+		t.Errorf("hookRun() output = %q, want nothing for unchanged files", buf.String())
+	}
+
+	// editing the file undoes the previous changes before loading again
+	if err := os.WriteFile(envyFilepath, []byte("echo reloading"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+
+	if err := hookRun(hookCmd, &buf); err != nil {
+		t.Fatalf("hookRun() unexpected error: %v", err)
+	}
+
+	if !strings.HasPrefix(buf.String(), "unset ENVY_HOOK_TEST\n. "+envyFilepath+"\n") {
+		t.Errorf("hookRun() output = %q, want the undo commands before the load commands", buf.String())
+	}
+
+	// a failure keeps the previous environment and only records the paths as checked
+	failing = true
+	if err := os.WriteFile(envyFilepath, []byte("echo failing"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+
+	if err := hookRun(hookCmd, &buf); err == nil {
+		t.Fatal("hookRun() expected an error")
+	}
+
+	lines = strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 || !strings.HasPrefix(lines[0], "export ENVY_STATE=") {
+		t.Fatalf("hookRun() output = %q, want only ENVY_STATE", buf.String())
+	}
+
+	failedState, err := shared.DecodeState(strings.TrimPrefix(lines[0], "export ENVY_STATE="))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if failedState.Key != state.Key || failedState.Checked != shared.LoadPathsKey([]string{envyFilepath}) {
+		t.Errorf("expected the loaded key to be kept and the failing one to be checked, got %+v", failedState)
+	}
+}
+
+func TestHookRun_InvalidState(t *testing.T) {
+	t.Setenv("ENVY_STATE", "!!!")
+
+	ctx := context.WithValue(context.Background(), "shell", &fakeShell{})
+	hookCmd.SetContext(ctx)
+
+	if err := hookRun(hookCmd, io.Discard); err == nil {
+		t.Error("hookRun() expected an error for an invalid ENVY_STATE")
+	}
+}
@@ -1,24 +1,43 @@
 package cmd
 
 import (
+	"envy/internal/app/shared"
 	"envy/internal/app/shell"
 	"errors"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/oklog/ulid/v2"
 	"github.com/spf13/cobra"
 )
 
+// where the executable of the parent process is looked up to detect the shell
+var procDir = "/proc"
+
 var initCmd = &cobra.Command{
-	Use:   "init SHELL",
+	Use:   "init [SHELL]",
 	Short: "Initialize an envy session",
-	Long:  `Outputs sh commands to initialize an envy session and register sh hooks.`,
-	Args:  cobra.ExactArgs(1),
+	Long: `Outputs sh commands to initialize an envy session and register sh hooks. When SHELL is omitted it is
+detected from the parent process, falling back to $SHELL.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: completeShellTypes,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return initRun(args[0], cmd.OutOrStdout())
+		if len(args) == 0 {
+			shellType, err := detectShell(os.Getppid())
+			if err != nil {
+				return err
+			}
+
+			return initRun(shellType, cmd.OutOrStdout(), cmd.ErrOrStderr())
+		}
+
+		return initRun(args[0], cmd.OutOrStdout(), cmd.ErrOrStderr())
 	},
 }
 
@@ -26,14 +45,105 @@ func init() {
 	rootCmd.AddCommand(initCmd)
 }
 
-func initRun(shellType string, writer io.Writer) error {
+func initRun(shellType string, writer io.Writer, errWriter io.Writer) error {
 	if !slices.Contains(shell.SupportedShellTypes, shellType) {
 		return errors.New(fmt.Sprintf("%s is not a supported shell type; valid values are [%s]", shellType, strings.Join(shell.SupportedShellTypes, ", ")))
 	}
 
+	inheritedKey := os.Getenv("ENVY_SESSION_KEY")
+
+	// the session is reused when the same shell is initialized again (e.g. source ~/.zshrc) so the hooks keep
+	// undoing what it loaded, and when the shell was exec'd since that keeps its pid
+	if len(inheritedKey) > 0 && os.Getenv("ENVY_SESSION_PID") == strconv.Itoa(os.Getppid()) {
+		return shell.NewShell(shellType, inheritedKey).Init(writer)
+	}
+
 	sessionKey := ulid.Make().String()
 
 	sh := shell.NewShell(shellType, sessionKey)
 
+	// a shell started from a managed one inherits its session key and the variables loaded there, so it gets
+	// its own session that adopts what the parent loaded; exiting it then only removes its own files. The same
+	// goes for a shell initialized again whose pid couldn't be matched, which keeps the previous session's files
+	// until it exits
+	if len(inheritedKey) > 0 {
+		err := adoptSession(sessionKey, inheritedKey)
+		if err != nil {
+			fmt.Fprintf(errWriter, "envy: could not adopt the parent session %s: %v\n", inheritedKey, err)
+		}
+	}
+
+	// remember the environment the session starts with for envy reset (an adopted session has the parent's)
+	if len(os.Getenv("ENVY_STATELESS")) == 0 && !shared.Exists(shared.SessionStateFilepath(sessionKey)) {
+		now := time.Now().UTC()
+
+		state := &shared.SessionState{
+			Version:   shared.SessionStateVersion,
+			Baseline:  shared.NewEnv(os.Environ()).Vars(),
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+
+		err := state.Save(sessionKey)
+		if err != nil {
+			fmt.Fprintf(errWriter, "envy: could not record the environment of the session: %v\n", err)
+		}
+	}
+
 	return sh.Init(writer)
 }
+
+// adoptSession copies the state of the parent session into a new session; there is no key saying the layers
+// are loaded yet so the first hook in the child undoes what the parent loaded and loads the envy files again
+// (which defines the functions and aliases that aren't inherited), with the profile the parent switched to
+func adoptSession(sessionKey string, parentKey string) error {
+	if profile, err := os.ReadFile(shared.SessionFilepath(parentKey, "profile")); err == nil {
+		err = writeKey(strings.TrimSpace(string(profile)), shared.SessionFilepath(sessionKey, "profile"))
+		if err != nil {
+			return err
+		}
+	}
+
+	state, err := shared.LoadSessionState(parentKey)
+	if errors.Is(err, shared.ErrNoSessionState) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	state.Parent = parentKey
+	state.CreatedAt = time.Now().UTC()
+
+	return state.Save(sessionKey)
+}
+
+// detectShell returns the shell type of the process that runs init (the shell evaluating its output) using
+// the executable of the parent process where /proc is available and names a supported shell, and $SHELL otherwise
+func detectShell(ppid int) (string, error) {
+	var detected string
+
+	if exe, err := os.Readlink(filepath.Join(procDir, strconv.Itoa(ppid), "exe")); err == nil {
+		detected = shellName(exe)
+	}
+
+	// the parent may run a versioned binary (zsh5) or a wrapper that isn't named after the shell
+	if loginShell := os.Getenv("SHELL"); !slices.Contains(shell.SupportedShellTypes, detected) && len(loginShell) > 0 {
+		detected = shellName(loginShell)
+	}
+
+	if len(detected) == 0 {
+		return "", fmt.Errorf("could not detect the shell; pass it explicitly, e.g. envy init %s", shell.SupportedShellTypes[0])
+	}
+
+	if !slices.Contains(shell.SupportedShellTypes, detected) {
+		return "", fmt.Errorf("detected %s which is not a supported shell type; valid values are [%s] (pass one explicitly, e.g. envy init %s)", detected, strings.Join(shell.SupportedShellTypes, ", "), shell.SupportedShellTypes[0])
+	}
+
+	return detected, nil
+}
+
+// shellName turns a path such as /usr/bin/zsh (or -zsh for login shells) into a shell type
+func shellName(path string) string {
+	return strings.TrimPrefix(filepath.Base(path), "-")
+}
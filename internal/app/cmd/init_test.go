@@ -2,8 +2,14 @@ package cmd
 
 import (
 	"bytes"
+	"envy/internal/app/shared"
 	"envy/internal/app/shell"
 	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -14,9 +20,9 @@ func TestInitCmd(t *testing.T) {
 		wantErr bool
 	}{
 		{
-			name:    "no args",
+			name:    "no args detects the shell",
 			args:    []string{"init"},
-			wantErr: true,
+			wantErr: false,
 		},
 		{
 			name:    "with 1 valid args",
@@ -32,6 +38,14 @@ func TestInitCmd(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			// the parent of the test binary isn't a shell so detection falls back to $SHELL
+			procDir = t.TempDir()
+			defer func() { procDir = "/proc" }()
+
+			t.Setenv("SHELL", "/bin/zsh")
+			t.Setenv("HOME", t.TempDir())
+			t.Setenv("ENVY_SESSION_KEY", "")
+
 			rootCmd.SetArgs(tt.args)
 			rootCmd.SetOut(io.Discard)
 			rootCmd.SetErr(io.Discard)
@@ -65,7 +79,10 @@ func TestInitRun(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := initRun(tt.shellType, &bytes.Buffer{})
+			t.Setenv("HOME", t.TempDir())
+			t.Setenv("ENVY_SESSION_KEY", "")
+
+			err := initRun(tt.shellType, &bytes.Buffer{}, io.Discard)
 
 			if (err != nil) != tt.wantErr {
 				t.Errorf("initRun() error = %v, wantErr %v", err, tt.wantErr)
@@ -73,3 +90,180 @@ func TestInitRun(t *testing.T) {
 		})
 	}
 }
+
+func TestInitRun_Baseline(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("ENVY_SESSION_KEY", "")
+	t.Setenv("ENVY_STATELESS", "")
+	t.Setenv("ENVY_INIT_BASELINE", "value")
+
+	var buf bytes.Buffer
+
+	if err := initRun("zsh", &buf, io.Discard); err != nil {
+		t.Fatalf("initRun() unexpected error: %v", err)
+	}
+
+	sessionKey := regexp.MustCompile(`ENVY_SESSION_KEY=(\S+)`).FindStringSubmatch(buf.String())[1]
+
+	state, err := shared.LoadSessionState(sessionKey)
+	if err != nil {
+		t.Fatalf("expected init to record the baseline: %v", err)
+	}
+
+	if state.Baseline["ENVY_INIT_BASELINE"] != "value" {
+		t.Errorf("expected the baseline to contain the environment init ran in, got %v", state.Baseline)
+	}
+}
+
+func TestInitRun_InheritedSession(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	parentKey := "01ARZ3NDEKTSV4RRFFQ69G5FAV"
+	parentState := &shared.SessionState{
+		Version: shared.SessionStateVersion,
+		Changes: []shared.EnvChange{{Key: "FOO", NewValue: "bar"}},
+	}
+	if err := parentState.Save(parentKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeKey("key", shared.SessionFilepath(parentKey, "key")); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeKey("staging", shared.SessionFilepath(parentKey, "profile")); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("ENVY_SESSION_KEY", parentKey)
+
+	// a shell started from the managed one gets a child session
+	t.Setenv("ENVY_SESSION_PID", "1")
+
+	var buf bytes.Buffer
+
+	if err := initRun("zsh", &buf, io.Discard); err != nil {
+		t.Fatalf("initRun() unexpected error: %v", err)
+	}
+
+	if strings.Contains(buf.String(), "ENVY_SESSION_KEY="+parentKey) {
+		t.Fatal("expected the child shell to get its own session key")
+	}
+
+	matches := regexp.MustCompile(`ENVY_SESSION_KEY=(\S+)`).FindStringSubmatch(buf.String())
+	if matches == nil {
+		t.Fatalf("no session key in %q", buf.String())
+	}
+
+	childKey := matches[1]
+
+	childState, err := shared.LoadSessionState(childKey)
+	if err != nil {
+		t.Fatalf("expected the child session to adopt the parent state: %v", err)
+	}
+
+	if childState.Parent != parentKey || len(childState.Changes) != 1 {
+		t.Errorf("child state = %+v, want the parent changes and key", childState)
+	}
+
+	if profile := sessionProfile(childKey); profile != "staging" {
+		t.Errorf("expected the child session to keep the parent profile, got %q", profile)
+	}
+
+	// the first hook in the child undoes and loads everything again
+	if shared.Exists(shared.SessionFilepath(childKey, "key")) {
+		t.Error("expected the child session to have no key")
+	}
+
+	if !shared.Exists(shared.SessionStateFilepath(parentKey)) {
+		t.Error("expected the parent session files to be left alone")
+	}
+
+	// initializing the same shell again (or exec'ing it) keeps its session, however many times it happens
+	t.Setenv("ENVY_SESSION_PID", strconv.Itoa(os.Getppid()))
+
+	for range 2 {
+		buf.Reset()
+
+		if err := initRun("zsh", &buf, io.Discard); err != nil {
+			t.Fatalf("initRun() unexpected error: %v", err)
+		}
+
+		if !strings.Contains(buf.String(), "ENVY_SESSION_KEY="+parentKey) {
+			t.Error("expected the same shell to keep its session key")
+		}
+	}
+}
+
+func TestDetectShell(t *testing.T) {
+	tests := []struct {
+		name     string
+		exe      string
+		shellEnv string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "parent process",
+			exe:      "/usr/bin/zsh",
+			shellEnv: "/bin/bash",
+			want:     "zsh",
+		},
+		{
+			name:     "unsupported parent process falls back to SHELL",
+			exe:      "/usr/bin/bash",
+			shellEnv: "/bin/zsh",
+			want:     "zsh",
+		},
+		{
+			name:     "versioned binary falls back to SHELL",
+			exe:      "/usr/bin/zsh5",
+			shellEnv: "/bin/zsh",
+			want:     "zsh",
+		},
+		{
+			name:     "unsupported parent process and SHELL",
+			exe:      "/usr/bin/bash",
+			shellEnv: "/bin/bash",
+			wantErr:  true,
+		},
+		{
+			name:     "fall back to SHELL",
+			shellEnv: "/usr/local/bin/zsh",
+			want:     "zsh",
+		},
+		{
+			name:     "login shell",
+			shellEnv: "-zsh",
+			want:     "zsh",
+		},
+		{
+			name:    "nothing to detect",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			procDir = t.TempDir()
+			defer func() { procDir = "/proc" }()
+
+			t.Setenv("SHELL", tt.shellEnv)
+
+			if len(tt.exe) > 0 {
+				os.MkdirAll(filepath.Join(procDir, "42"), 0755)
+				if err := os.Symlink(tt.exe, filepath.Join(procDir, "42", "exe")); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := detectShell(42)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("detectShell() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("detectShell() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"envy/internal/app/shared"
+	"envy/internal/app/shell"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var profileClear bool
+
+var profileCmd = &cobra.Command{
+	Use:   "profile COMMAND",
+	Short: "Switch the profile of the session",
+	Long: `Profiles load an envy.<profile>.sh file after the envy.sh file (and its drop-ins) of each directory, e.g.
+envy.staging.sh to run a project against other credentials. The profile is ENVY_PROFILE unless the session
+picked another one with envy profile use.`,
+}
+
+var profileUseCmd = &cobra.Command{
+	Use:   "use PROFILE",
+	Short: "Load the envy files of another profile in the session",
+	Long: `Loads the envy.<PROFILE>.sh files instead of the ones of the current profile before the next prompt, until
+envy profile use --clear goes back to ENVY_PROFILE.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: completeProfiles,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return genPreRun(cmd)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if profileClear == (len(args) > 0) {
+			return errors.New("pass either a profile or --clear")
+		}
+
+		cmd.SilenceUsage = true
+
+		if profileClear {
+			return profileUseRun(cmd, "")
+		}
+
+		return profileUseRun(cmd, args[0])
+	},
+}
+
+var profileListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the profiles of the current directory",
+	Long: `Prints the profiles with an envy.<profile>.sh file in the directory the session loads (or its parents),
+marking the active one with *.`,
+	Args: cobra.NoArgs,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return genPreRun(cmd)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return profileListRun(cmd, cmd.OutOrStdout())
+	},
+}
+
+var profileCurrentCmd = &cobra.Command{
+	Use:   "current",
+	Short: "Print the profile of the session",
+	Long:  `Prints the active profile, or nothing when the session doesn't use one.`,
+	Args:  cobra.NoArgs,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return genPreRun(cmd)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return profileCurrentRun(cmd, cmd.OutOrStdout())
+	},
+}
+
+func init() {
+	profileUseCmd.Flags().BoolVar(&profileClear, "clear", false, "go back to the profile in ENVY_PROFILE")
+
+	profileCmd.AddCommand(profileUseCmd, profileListCmd, profileCurrentCmd)
+	rootCmd.AddCommand(profileCmd)
+}
+
+// profileUseRun switches the session to profile, or back to ENVY_PROFILE when profile is empty
+func profileUseRun(cmd *cobra.Command, profile string) error {
+	sessionKey, _ := cmd.Context().Value("sessionKey").(string)
+
+	if len(os.Getenv("ENVY_STATELESS")) > 0 {
+		return errStateless
+	}
+
+	name := shared.SessionFilepath(sessionKey, "profile")
+
+	if len(profile) == 0 {
+		err := os.Remove(name)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		if !shared.ValidProfile(profile) {
+			return fmt.Errorf("%s is not a valid profile; use letters, digits, - and _ only", profile)
+		}
+
+		// switching to a profile without files is allowed (they may be added later) but most likely a typo
+		if profiles := profileNames(cmd); !slices.Contains(profiles, profile) {
+			fmt.Fprintf(cmd.ErrOrStderr(), "envy: no envy files for profile %s here\n", profile)
+		}
+
+		err := writeLines([]string{profile}, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	// make the hooks reload before the next prompt
+	err := os.Remove(shared.SessionFilepath(sessionKey, "checked"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func profileListRun(cmd *cobra.Command, writer io.Writer) error {
+	sessionKey, _ := cmd.Context().Value("sessionKey").(string)
+	current := sessionProfile(sessionKey)
+
+	for _, profile := range profileNames(cmd) {
+		if profile == current {
+			fmt.Fprintf(writer, "* %s\n", profile)
+		} else {
+			fmt.Fprintf(writer, "  %s\n", profile)
+		}
+	}
+
+	return nil
+}
+
+func profileCurrentRun(cmd *cobra.Command, writer io.Writer) error {
+	sessionKey, _ := cmd.Context().Value("sessionKey").(string)
+
+	if profile := sessionProfile(sessionKey); len(profile) > 0 {
+		fmt.Fprintln(writer, profile)
+	}
+
+	return nil
+}
+
+// profileNames returns the profiles of the directory the session loads the envy files of (sh specific)
+func profileNames(cmd *cobra.Command) []string {
+	sh, _ := cmd.Context().Value("shell").(shell.Shell)
+	sessionKey, _ := cmd.Context().Value("sessionKey").(string)
+
+	currentDir, err := os.Getwd()
+	if err != nil {
+		return nil
+	}
+
+	return sh.FindProfiles(sessionDir(sessionKey, currentDir))
+}
+
+// sessionProfile returns the profile picked by envy profile use in the session, or ENVY_PROFILE
+func sessionProfile(sessionKey string) string {
+	if len(sessionKey) > 0 {
+		content, err := os.ReadFile(shared.SessionFilepath(sessionKey, "profile"))
+		if err == nil {
+			return strings.TrimSpace(string(content))
+		}
+	}
+
+	return os.Getenv("ENVY_PROFILE")
+}
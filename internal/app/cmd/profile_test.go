@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"envy/internal/app/shared"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProfileUseRun(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("ENVY_STATELESS", "")
+	t.Setenv("ENVY_PROFILE", "dev")
+
+	fake := &fakeShell{
+		findLoadPaths:  func(dir string) []string { return []string{filepath.Join(dir, "envy.sh")} },
+		findProfiles:   func(_ string) []string { return []string{"dev", "staging"} },
+		getSubshellCmd: func(_ []string) *exec.Cmd { return exec.Command("sh", "-c", "env") },
+		genLoadFile: func(paths []string) ([]string, string) {
+			return []string{}, filepath.Join(tmp, "session.load.sh")
+		},
+		genUndoFile: func(_ []shared.EnvChange) ([]string, string) {
+			return []string{}, filepath.Join(tmp, "session.undo.sh")
+		},
+	}
+
+	ctx := context.WithValue(context.Background(), "shell", fake)
+	ctx = context.WithValue(ctx, "sessionKey", "12345678")
+	profileUseCmd.SetContext(ctx)
+	genCmd.SetContext(ctx)
+	genCmd.SetErr(io.Discard)
+	defer genCmd.SetErr(nil)
+
+	// the session starts with ENVY_PROFILE
+	if err := genRun(genCmd); err != nil {
+		t.Fatalf("genRun() unexpected error: %v", err)
+	}
+
+	if fake.profile != "dev" {
+		t.Errorf("expected gen to load the ENVY_PROFILE profile, got %q", fake.profile)
+	}
+
+	if err := profileUseRun(profileUseCmd, "../staging"); err == nil {
+		t.Error("profileUseRun() expected an error for an invalid profile")
+	}
+
+	if err := writeKey("key", shared.SessionFilepath("12345678", "checked")); err != nil {
+		t.Fatal(err)
+	}
+
+	var stderr bytes.Buffer
+	profileUseCmd.SetErr(&stderr)
+	defer profileUseCmd.SetErr(nil)
+
+	if err := profileUseRun(profileUseCmd, "staging"); err != nil {
+		t.Fatalf("profileUseRun() unexpected error: %v", err)
+	}
+
+	if shared.Exists(shared.SessionFilepath("12345678", "checked")) {
+		t.Error("expected the hooks to reload after switching the profile")
+	}
+
+	if stderr.Len() > 0 {
+		t.Errorf("expected no warning for a profile with files, got %q", stderr.String())
+	}
+
+	if err := genRun(genCmd); err != nil {
+		t.Fatalf("genRun() unexpected error: %v", err)
+	}
+
+	if fake.profile != "staging" {
+		t.Errorf("expected gen to load the profile of the session, got %q", fake.profile)
+	}
+
+	// a profile without files is most likely a typo
+	if err := profileUseRun(profileUseCmd, "stagign"); err != nil {
+		t.Fatalf("profileUseRun() unexpected error: %v", err)
+	}
+
+	if !strings.Contains(stderr.String(), "no envy files for profile stagign") {
+		t.Errorf("expected a warning for a profile without files, got %q", stderr.String())
+	}
+
+	// --clear goes back to ENVY_PROFILE
+	if err := profileUseRun(profileUseCmd, ""); err != nil {
+		t.Fatalf("profileUseRun() unexpected error: %v", err)
+	}
+
+	if profile := sessionProfile("12345678"); profile != "dev" {
+		t.Errorf("sessionProfile() = %q after clearing, want dev", profile)
+	}
+
+	t.Setenv("ENVY_STATELESS", "1")
+
+	if err := profileUseRun(profileUseCmd, "staging"); err == nil {
+		t.Error("profileUseRun() expected an error in a stateless session")
+	}
+}
+
+func TestProfileListRun(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("ENVY_PROFILE", "staging")
+
+	fake := &fakeShell{
+		findProfiles: func(_ string) []string { return []string{"dev", "staging"} },
+	}
+
+	ctx := context.WithValue(context.Background(), "shell", fake)
+	ctx = context.WithValue(ctx, "sessionKey", "12345678")
+	profileListCmd.SetContext(ctx)
+
+	var buf bytes.Buffer
+
+	if err := profileListRun(profileListCmd, &buf); err != nil {
+		t.Fatalf("profileListRun() unexpected error: %v", err)
+	}
+
+	if want := "  dev\n* staging\n"; buf.String() != want {
+		t.Errorf("profileListRun() output = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestProfileCurrentRun(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("ENVY_PROFILE", "")
+
+	ctx := context.WithValue(context.Background(), "sessionKey", "12345678")
+	profileCurrentCmd.SetContext(ctx)
+
+	var buf bytes.Buffer
+
+	if err := profileCurrentRun(profileCurrentCmd, &buf); err != nil || buf.Len() > 0 {
+		t.Errorf("profileCurrentRun() = %q, %v, want no output without a profile", buf.String(), err)
+	}
+
+	if err := writeKey("prod", shared.SessionFilepath("12345678", "profile")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf.Reset()
+
+	if err := profileCurrentRun(profileCurrentCmd, &buf); err != nil || buf.String() != "prod\n" {
+		t.Errorf("profileCurrentRun() = %q, %v, want prod", buf.String(), err)
+	}
+}
+
+func TestProfileUseCmd(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "no args", args: []string{"profile", "use"}},
+		{name: "profile and clear", args: []string{"profile", "use", "dev", "--clear"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ENVY_SHELL", "zsh")
+			t.Setenv("ENVY_SESSION_KEY", "12345678")
+			t.Setenv("HOME", t.TempDir())
+
+			rootCmd.SetArgs(tt.args)
+			rootCmd.SetOut(io.Discard)
+			rootCmd.SetErr(io.Discard)
+			defer profileUseCmd.Flags().Set("clear", "false")
+
+			if err := rootCmd.Execute(); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"envy/internal/app/shared"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var reloadCmd = &cobra.Command{
+	Use:   "reload",
+	Short: "Reload the envy files for the current directory",
+	Long: `Forgets what was loaded last for the session so the shell hooks undo and reload the envy.sh files for the
+current directory before the next prompt, even when they haven't changed (bypassing the cache of envy daemon).`,
+	Args: cobra.NoArgs,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return genPreRun(cmd)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return reloadRun(cmd)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reloadCmd)
+}
+
+func reloadRun(cmd *cobra.Command) error {
+	sessionKey, _ := cmd.Context().Value("sessionKey").(string)
+
+	for _, suffix := range []string{"checked", "key"} {
+		err := os.Remove(shared.SessionFilepath(sessionKey, suffix))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	// the daemon would otherwise serve what it evaluated before since the files and the env are the same
+	return writeKey("reload", shared.SessionFilepath(sessionKey, "reload"))
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"context"
+	"envy/internal/app/daemon"
+	"envy/internal/app/shared"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestReloadRun(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+
+	ctx := context.WithValue(context.Background(), "sessionKey", "12345678")
+	reloadCmd.SetContext(ctx)
+
+	// nothing to forget yet
+	if err := reloadRun(reloadCmd); err != nil {
+		t.Fatalf("reloadRun() unexpected error: %v", err)
+	}
+
+	for _, suffix := range []string{"checked", "key"} {
+		if err := writeKey("key", shared.SessionFilepath("12345678", suffix)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := reloadRun(reloadCmd); err != nil {
+		t.Fatalf("reloadRun() unexpected error: %v", err)
+	}
+
+	for _, suffix := range []string{"checked", "key"} {
+		if shared.Exists(shared.SessionFilepath("12345678", suffix)) {
+			t.Errorf("expected the %s file to be removed", suffix)
+		}
+	}
+
+	if !shared.Exists(shared.SessionFilepath("12345678", "reload")) {
+		t.Error("expected the next gen to be asked to bypass the daemon's cache")
+	}
+}
+
+func TestReloadRun_Daemon(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("ENVY_STATELESS", "")
+	t.Setenv("XDG_RUNTIME_DIR", tmp)
+	t.Chdir(tmp)
+
+	os.WriteFile(filepath.Join(tmp, "envy.sh"), []byte("export ENVY_RELOAD_TEST=1"), 0644)
+
+	var refreshes []bool
+
+	server, err := daemon.NewServer(func(_ context.Context, request daemon.Request) ([]string, error) {
+		refreshes = append(refreshes, request.Refresh)
+		return slices.Concat(request.Environ, []string{"ENVY_RELOAD_TEST=1"}), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	os.MkdirAll(filepath.Dir(daemon.SocketPath()), 0700)
+
+	listener, err := net.Listen("unix", daemon.SocketPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go server.Serve(listener)
+
+	fake := &fakeShell{
+		findLoadPaths: func(dir string) []string { return shared.FindLoadPaths(dir, "envy.sh", "") },
+		genLoadFile: func(paths []string) ([]string, string) {
+			return []string{}, filepath.Join(tmp, "session.load.sh")
+		},
+		genUndoFile: func(_ []shared.EnvChange) ([]string, string) {
+			return []string{}, filepath.Join(tmp, "session.undo.sh")
+		},
+	}
+
+	ctx := context.WithValue(context.Background(), "shell", fake)
+	ctx = context.WithValue(ctx, "sessionKey", "12345678")
+	genCmd.SetContext(ctx)
+	reloadCmd.SetContext(ctx)
+	genCmd.SetErr(io.Discard)
+	defer genCmd.SetErr(nil)
+
+	if err := genRun(genCmd); err != nil {
+		t.Fatalf("genRun() unexpected error: %v", err)
+	}
+
+	if err := reloadRun(reloadCmd); err != nil {
+		t.Fatalf("reloadRun() unexpected error: %v", err)
+	}
+
+	// the shell reloads on top of the same env, which the daemon has cached
+	t.Setenv("ENVY_RELOAD_TEST", "1")
+
+	if err := genRun(genCmd); err != nil {
+		t.Fatalf("genRun() unexpected error: %v", err)
+	}
+
+	if want := []bool{false, true}; !slices.Equal(refreshes, want) {
+		t.Fatalf("daemon evaluated with refresh %v, want %v", refreshes, want)
+	}
+
+	if shared.Exists(shared.SessionFilepath("12345678", "reload")) {
+		t.Error("expected the refresh to only apply to the gen after envy reload")
+	}
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"envy/internal/app/shared"
+	"envy/internal/app/shell"
+	"errors"
+	"os"
+	"slices"
+
+	"github.com/spf13/cobra"
+)
+
+var resetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Restore the environment the session started with",
+	Long: `Restores exactly the environment captured when the session was initialized before the next prompt, undoing
+everything loaded (and exported by hand) since, and suspends loading envy.sh files until envy resume is run.`,
+	Args: cobra.NoArgs,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return genPreRun(cmd)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return resetRun(cmd)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(resetCmd)
+}
+
+func resetRun(cmd *cobra.Command) error {
+	sessionKey, _ := cmd.Context().Value("sessionKey").(string)
+
+	if len(os.Getenv("ENVY_STATELESS")) > 0 {
+		return errStateless
+	}
+
+	lock, err := shared.LockSession(sessionKey, shell.Timeout()+lockTimeoutMargin)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	state, err := shared.LoadSessionState(sessionKey)
+	if errors.Is(err, shared.ErrNoSessionState) || (err == nil && state.Baseline == nil) {
+		return errors.New("no baseline was recorded for this session; start a new shell")
+	}
+	if err != nil {
+		return err
+	}
+
+	var baselineLines []string
+	for key, value := range state.Baseline {
+		baselineLines = append(baselineLines, key+"="+value)
+	}
+
+	// record everything that changed since the baseline (loaded or not) as a single layer, leaving the vars
+	// identifying the session and the ones the shell maintains alone, so the hooks undo all of it before the
+	// next prompt
+	changes := shared.NewEnv(baselineLines).Diff(shared.NewEnv(os.Environ()))
+	changes = slices.DeleteFunc(changes, func(change shared.EnvChange) bool {
+		return slices.Contains(shared.SessionEnvVars, change.Key) || slices.Contains(shared.ShellEnvVars, change.Key)
+	})
+
+	state.Layers = []shared.Layer{{Changes: changes}}
+	state.LoadPaths = nil
+	state.Changes = changes
+
+	err = state.Save(sessionKey)
+	if err != nil {
+		return err
+	}
+
+	// without a key gen undoes every layer, even if the session was suspended already; nothing is loaded on top
+	// of the baseline until envy resume
+	err = os.Remove(shared.SessionFilepath(sessionKey, "key"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return setSuspended(sessionKey, true)
+}
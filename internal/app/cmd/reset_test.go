@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"context"
+	"envy/internal/app/shared"
+	"envy/internal/app/shell"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestResetRun(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("ENVY_STATELESS", "")
+	t.Setenv("ENVY_SESSION_KEY", "")
+	t.Setenv("ENVY_RESET_CHANGED", "base")
+	t.Setenv("ENVY_RESET_REMOVED", "base")
+
+	// init ran in another directory than the one reset runs in
+	initDir := filepath.Join(tmp, "init")
+	os.Mkdir(initDir, 0755)
+	t.Chdir(initDir)
+	t.Setenv("PWD", initDir)
+
+	var undone []shared.EnvChange
+
+	fake := &fakeShell{
+		findLoadPaths: func(_ string) []string { return []string{filepath.Join(tmp, "envy.sh")} },
+		genLoadFile: func(paths []string) ([]string, string) {
+			return paths, filepath.Join(tmp, "session.load.sh")
+		},
+		genUndoFile: func(changes []shared.EnvChange) ([]string, string) {
+			undone = changes
+			return []string{}, filepath.Join(tmp, "session.undo.sh")
+		},
+	}
+
+	ctx := context.WithValue(context.Background(), "shell", fake)
+	ctx = context.WithValue(ctx, "sessionKey", "12345678")
+	resetCmd.SetContext(ctx)
+	genCmd.SetContext(ctx)
+	genCmd.SetErr(io.Discard)
+	defer genCmd.SetErr(nil)
+
+	if err := resetRun(resetCmd); err == nil {
+		t.Fatal("resetRun() expected an error without a baseline")
+	}
+
+	state := &shared.SessionState{
+		Version:  shared.SessionStateVersion,
+		Baseline: shared.NewEnv(os.Environ()).Vars(),
+	}
+	if err := state.Save("12345678"); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeKey("key", shared.SessionFilepath("12345678", "key")); err != nil {
+		t.Fatal(err)
+	}
+
+	// what was loaded and exported since the session started
+	t.Setenv("ENVY_RESET_CHANGED", "loaded")
+	t.Setenv("ENVY_RESET_ADDED", "loaded")
+	os.Unsetenv("ENVY_RESET_REMOVED")
+	t.Setenv("ENVY_SESSION_KEY", "12345678")
+	t.Chdir(tmp)
+	t.Setenv("PWD", tmp)
+
+	if err := resetRun(resetCmd); err != nil {
+		t.Fatalf("resetRun() unexpected error: %v", err)
+	}
+
+	if !isSuspended("12345678") || shared.Exists(shared.SessionFilepath("12345678", "key")) {
+		t.Error("expected the session to be suspended and gen to undo every layer next time")
+	}
+
+	// the next hook undoes everything since the baseline and loads nothing
+	if err := genRun(genCmd); err != nil {
+		t.Fatalf("genRun() unexpected error: %v", err)
+	}
+
+	want := []shared.EnvChange{
+		{Key: "ENVY_RESET_ADDED", NewValue: "loaded"},
+		{Key: "ENVY_RESET_CHANGED", OldValue: "base", NewValue: "loaded"},
+		{Key: "ENVY_RESET_REMOVED", OldValue: "base"},
+	}
+
+	if !slices.Equal(undone, want) {
+		t.Errorf("resetRun() undo changes = %+v, want %+v", undone, want)
+	}
+
+	if load, _ := os.ReadFile(filepath.Join(tmp, "session.load.sh")); len(load) > 0 {
+		t.Errorf("expected nothing to be loaded after a reset, got %q", load)
+	}
+}
+
+func TestResetRun_Quoting(t *testing.T) {
+	// the undo script sticks to what bash understands too
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not installed")
+	}
+
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("ENVY_STATELESS", "")
+	t.Setenv("ENVY_SESSION_KEY", "12345678")
+	t.Chdir(tmp)
+
+	marker := filepath.Join(tmp, "ran")
+	baseline := map[string]string{
+		"ENVY_RESET_SPACES":  "-R -F",
+		"ENVY_RESET_COMMAND": "a; touch " + marker + " $(touch " + marker + ") 'b' c",
+	}
+
+	for key, value := range baseline {
+		t.Setenv(key, value)
+	}
+
+	state := &shared.SessionState{
+		Version:  shared.SessionStateVersion,
+		Baseline: shared.NewEnv(os.Environ()).Vars(),
+	}
+	if err := state.Save("12345678"); err != nil {
+		t.Fatal(err)
+	}
+
+	// changed since the session started
+	for key := range baseline {
+		t.Setenv(key, "loaded")
+	}
+
+	ctx := context.WithValue(context.Background(), "shell", shell.NewShell("zsh", "12345678"))
+	ctx = context.WithValue(ctx, "sessionKey", "12345678")
+	resetCmd.SetContext(ctx)
+	genCmd.SetContext(ctx)
+	genCmd.SetErr(io.Discard)
+	defer genCmd.SetErr(nil)
+
+	if err := resetRun(resetCmd); err != nil {
+		t.Fatalf("resetRun() unexpected error: %v", err)
+	}
+
+	if err := genRun(genCmd); err != nil {
+		t.Fatalf("genRun() unexpected error: %v", err)
+	}
+
+	for key, value := range baseline {
+		script := fmt.Sprintf(". %s; printf %%s \"$%s\"", shared.SessionFilepath("12345678", "undo.sh"), key)
+
+		output, err := exec.Command("bash", "-c", script).Output()
+		if err != nil {
+			t.Fatalf("sourcing the undo script failed: %v", err)
+		}
+
+		if string(output) != value {
+			t.Errorf("undo script restored %s=%q, want %q", key, output, value)
+		}
+	}
+
+	if shared.Exists(marker) {
+		t.Error("expected the undo script not to run anything in the restored values")
+	}
+}
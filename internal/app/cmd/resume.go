@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var resumeCmd = &cobra.Command{
+	Use:   "resume",
+	Short: "Load the envy files again after suspend or reset",
+	Long:  `Loads the envy.sh files for the current directory again before the next prompt after envy suspend or envy reset.`,
+	Args:  cobra.NoArgs,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return genPreRun(cmd)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return resumeRun(cmd)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(resumeCmd)
+}
+
+func resumeRun(cmd *cobra.Command) error {
+	sessionKey, _ := cmd.Context().Value("sessionKey").(string)
+
+	if len(os.Getenv("ENVY_STATELESS")) > 0 {
+		return errStateless
+	}
+
+	return setSuspended(sessionKey, false)
+}
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"context"
+	"envy/internal/app/shared"
+	"testing"
+)
+
+func TestResumeRun(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("ENVY_STATELESS", "")
+
+	resumeCmd.SetContext(context.WithValue(context.Background(), "sessionKey", "12345678"))
+
+	// resuming a session that isn't suspended is a no-op
+	if err := resumeRun(resumeCmd); err != nil {
+		t.Fatalf("resumeRun() unexpected error: %v", err)
+	}
+
+	if err := setSuspended("12345678", true); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := resumeRun(resumeCmd); err != nil {
+		t.Fatalf("resumeRun() unexpected error: %v", err)
+	}
+
+	if isSuspended("12345678") || shared.Exists(shared.SessionFilepath("12345678", "suspended")) {
+		t.Error("expected the session to be resumed")
+	}
+}
@@ -11,7 +11,5 @@ var rootCmd = &cobra.Command{
 }
 
 func Execute() error {
-	rootCmd.CompletionOptions.DisableDefaultCmd = true
-
 	return rootCmd.Execute()
 }
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"encoding/json"
+	"envy/internal/app/shared"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var statusJSON bool
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show what envy loaded in the current session",
+	Long: `Prints the envy.sh files loaded in the current session (flagging the ones modified or deleted since),
+the variables they changed and when they were loaded, as recorded in the session state.`,
+	Args: cobra.NoArgs,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return genPreRun(cmd)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return statusRun(cmd, cmd.OutOrStdout(), statusJSON)
+	},
+}
+
+func init() {
+	statusCmd.Flags().BoolVar(&statusJSON, "json", false, "print the session state as JSON")
+
+	rootCmd.AddCommand(statusCmd)
+}
+
+func statusRun(cmd *cobra.Command, writer io.Writer, asJSON bool) error {
+	sessionKey, _ := cmd.Context().Value("sessionKey").(string)
+
+	// stateless sessions only carry the changes in ENVY_STATE
+	if len(os.Getenv("ENVY_STATELESS")) > 0 {
+		state, err := shared.DecodeState(os.Getenv("ENVY_STATE"))
+		if err != nil {
+			return fmt.Errorf("could not decode ENVY_STATE: %w", err)
+		}
+
+		if asJSON {
+			return writeJSON(writer, state)
+		}
+
+		fmt.Fprintf(writer, "changes: %s\n", changeSummary(state.Changes))
+		return nil
+	}
+
+	state, err := shared.LoadSessionState(sessionKey)
+	if errors.Is(err, shared.ErrNoSessionState) {
+		if asJSON {
+			return writeJSON(writer, nil)
+		}
+
+		fmt.Fprintln(writer, "nothing loaded in this session")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		return writeJSON(writer, state)
+	}
+
+	if len(state.Parent) > 0 {
+		fmt.Fprintf(writer, "parent: %s\n", state.Parent)
+	}
+
+	fmt.Fprintf(writer, "dir: %s\n", state.Dir)
+
+	if pinned := pinnedDir(sessionKey); len(pinned) > 0 {
+		fmt.Fprintf(writer, "pinned: %s (envy use --clear loads the current directory again)\n", pinned)
+	}
+
+	if profile := sessionProfile(sessionKey); len(profile) > 0 {
+		fmt.Fprintf(writer, "profile: %s\n", profile)
+	}
+
+	if isSuspended(sessionKey) {
+		fmt.Fprintln(writer, "suspended: yes (envy resume loads the envy files again)")
+	}
+
+	if len(state.LoadPaths) == 0 {
+		fmt.Fprintln(writer, "loaded: nothing")
+	} else {
+		fmt.Fprintln(writer, "loaded:")
+	}
+
+	for _, loadPath := range state.LoadPaths {
+		hash := shared.HashFile(loadPath.Path)
+
+		switch {
+		case len(hash) == 0:
+			fmt.Fprintf(writer, "  %s (deleted)\n", loadPath.Path)
+		case hash != loadPath.Hash:
+			fmt.Fprintf(writer, "  %s (modified)\n", loadPath.Path)
+		default:
+			fmt.Fprintf(writer, "  %s\n", loadPath.Path)
+		}
+	}
+
+	fmt.Fprintf(writer, "changes: %s\n", changeSummary(state.Changes))
+	fmt.Fprintf(writer, "updated: %s\n", state.UpdatedAt.Local().Format(time.RFC3339))
+
+	return nil
+}
+
+// changeSummary lists the changed keys in the same +added ~changed -removed form as the load summary
+func changeSummary(changes []shared.EnvChange) string {
+	if len(changes) == 0 {
+		return "none"
+	}
+
+	var tokens []string
+	for _, change := range changes {
+		tokens = append(tokens, change.Sign()+change.Key)
+	}
+
+	slices.SortFunc(tokens, func(a, b string) int { return strings.Compare(a[1:], b[1:]) })
+
+	return strings.Join(tokens, " ")
+}
+
+func writeJSON(writer io.Writer, v any) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(v)
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"envy/internal/app/shared"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusRun(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("ENVY_STATELESS", "")
+
+	ctx := context.WithValue(context.Background(), "sessionKey", "12345678")
+	statusCmd.SetContext(ctx)
+
+	var buf bytes.Buffer
+
+	if err := statusRun(statusCmd, &buf, false); err != nil {
+		t.Fatalf("statusRun() unexpected error: %v", err)
+	}
+
+	if !strings.Contains(buf.String(), "nothing loaded") {
+		t.Errorf("statusRun() output = %q, want nothing loaded", buf.String())
+	}
+
+	unchangedFilepath := filepath.Join(tmp, "a.sh")
+	modifiedFilepath := filepath.Join(tmp, "b.sh")
+	deletedFilepath := filepath.Join(tmp, "c.sh")
+
+	for _, path := range []string{unchangedFilepath, modifiedFilepath, deletedFilepath} {
+		os.WriteFile(path, []byte("export FOO=bar"), 0644)
+	}
+
+	state := &shared.SessionState{
+		Version:   shared.SessionStateVersion,
+		Dir:       tmp,
+		LoadPaths: shared.NewLoadPaths([]string{unchangedFilepath, modifiedFilepath, deletedFilepath}),
+		Changes:   []shared.EnvChange{{Key: "FOO", NewValue: "bar"}, {Key: "BAR", OldValue: "baz"}, {Key: "PATH", OldValue: "/bin", NewValue: "/a:/bin"}},
+		UpdatedAt: time.Now(),
+	}
+	if err := state.Save("12345678"); err != nil {
+		t.Fatal(err)
+	}
+
+	os.WriteFile(modifiedFilepath, []byte("export FOO=baz"), 0644)
+	os.Remove(deletedFilepath)
+
+	buf.Reset()
+
+	if err := statusRun(statusCmd, &buf, false); err != nil {
+		t.Fatalf("statusRun() unexpected error: %v", err)
+	}
+
+	for _, want := range []string{"  " + unchangedFilepath + "\n", modifiedFilepath + " (modified)", deletedFilepath + " (deleted)", "changes: -BAR +FOO ~PATH\n"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected the output to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+
+	// the json output is the session state itself
+	buf.Reset()
+
+	if err := statusRun(statusCmd, &buf, true); err != nil {
+		t.Fatalf("statusRun() unexpected error: %v", err)
+	}
+
+	var decoded shared.SessionState
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || len(decoded.Changes) != 3 {
+		t.Errorf("statusRun() json output = %q, want the session state", buf.String())
+	}
+}
+
+func TestStatusRun_Stateless(t *testing.T) {
+	state, _ := shared.EncodeState(shared.State{Changes: []shared.EnvChange{{Key: "FOO", NewValue: "bar"}}})
+
+	t.Setenv("ENVY_STATELESS", "1")
+	t.Setenv("ENVY_STATE", state)
+
+	statusCmd.SetContext(context.Background())
+
+	var buf bytes.Buffer
+
+	if err := statusRun(statusCmd, &buf, false); err != nil {
+		t.Fatalf("statusRun() unexpected error: %v", err)
+	}
+
+	if buf.String() != "changes: +FOO\n" {
+		t.Errorf("statusRun() output = %q, want the changes from ENVY_STATE", buf.String())
+	}
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"envy/internal/app/shared"
+	"errors"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var errStateless = errors.New("not supported with ENVY_STATELESS (nothing is written to disk for the hooks to pick up)")
+
+var suspendCmd = &cobra.Command{
+	Use:   "suspend",
+	Short: "Unload the envy files and stop loading them until resume",
+	Long: `Undoes what envy loaded in the current session before the next prompt and stops loading envy.sh files,
+whichever directory you change to, until envy resume is run.`,
+	Args: cobra.NoArgs,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return genPreRun(cmd)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return suspendRun(cmd)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(suspendCmd)
+}
+
+func suspendRun(cmd *cobra.Command) error {
+	sessionKey, _ := cmd.Context().Value("sessionKey").(string)
+
+	if len(os.Getenv("ENVY_STATELESS")) > 0 {
+		return errStateless
+	}
+
+	return setSuspended(sessionKey, true)
+}
+
+func isSuspended(sessionKey string) bool {
+	return len(sessionKey) > 0 && shared.Exists(shared.SessionFilepath(sessionKey, "suspended"))
+}
+
+// setSuspended writes or removes the marker gen and check look for, and forgets which load paths were checked
+// so the hooks undo (or load) the envy files before the next prompt
+func setSuspended(sessionKey string, suspended bool) error {
+	name := shared.SessionFilepath(sessionKey, "suspended")
+
+	var err error
+	if suspended {
+		err = writeLines(nil, name)
+	} else {
+		err = os.Remove(name)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	err = os.Remove(shared.SessionFilepath(sessionKey, "checked"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
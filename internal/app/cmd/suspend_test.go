@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"context"
+	"envy/internal/app/shared"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestSuspendRun(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("ENVY_STATELESS", "")
+
+	envyFilepath := filepath.Join(tmp, "envy.sh")
+
+	var loaded []string
+
+	fake := &fakeShell{
+		findLoadPaths:  func(_ string) []string { return []string{envyFilepath} },
+		getSubshellCmd: func(_ []string) *exec.Cmd { return exec.Command("sh", "-c", "env") },
+		genLoadFile: func(paths []string) ([]string, string) {
+			loaded = paths
+			return []string{}, filepath.Join(tmp, "session.load.sh")
+		},
+		genUndoFile: func(_ []shared.EnvChange) ([]string, string) {
+			return []string{}, filepath.Join(tmp, "session.undo.sh")
+		},
+	}
+
+	ctx := context.WithValue(context.Background(), "shell", fake)
+	ctx = context.WithValue(ctx, "sessionKey", "12345678")
+
+	for _, cmd := range []*cobra.Command{genCmd, checkCmd, suspendCmd, resumeCmd} {
+		cmd.SetContext(ctx)
+	}
+	genCmd.SetErr(io.Discard)
+	defer genCmd.SetErr(nil)
+
+	if err := genRun(genCmd); err != nil || len(loaded) != 1 {
+		t.Fatalf("genRun() error = %v, loaded %v", err, loaded)
+	}
+
+	if err := suspendRun(suspendCmd); err != nil {
+		t.Fatalf("suspendRun() unexpected error: %v", err)
+	}
+
+	// the hooks pick it up before the next prompt and gen loads nothing while suspended
+	if err := checkRun(checkCmd); err == nil {
+		t.Error("checkRun() expected the session to need a reload after suspend")
+	}
+
+	if err := genRun(genCmd); err != nil || len(loaded) != 0 {
+		t.Fatalf("genRun() error = %v, loaded %v while suspended", err, loaded)
+	}
+
+	if err := checkRun(checkCmd); err != nil {
+		t.Errorf("checkRun() unexpected error while suspended: %v", err)
+	}
+
+	if err := resumeRun(resumeCmd); err != nil {
+		t.Fatalf("resumeRun() unexpected error: %v", err)
+	}
+
+	if err := checkRun(checkCmd); err == nil {
+		t.Error("checkRun() expected the session to need a reload after resume")
+	}
+
+	if err := genRun(genCmd); err != nil || len(loaded) != 1 {
+		t.Fatalf("genRun() error = %v, loaded %v after resume", err, loaded)
+	}
+}
+
+func TestSuspendRun_Stateless(t *testing.T) {
+	t.Setenv("ENVY_STATELESS", "1")
+
+	suspendCmd.SetContext(context.WithValue(context.Background(), "sessionKey", "12345678"))
+
+	if err := suspendRun(suspendCmd); err == nil {
+		t.Error("suspendRun() expected an error with ENVY_STATELESS")
+	}
+}
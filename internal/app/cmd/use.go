@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"envy/internal/app/shared"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var useClear bool
+
+var useCmd = &cobra.Command{
+	Use:   "use DIR",
+	Short: "Pin the session to the envy files of another directory",
+	Long: `Loads the envy.sh files of DIR (and its parents) instead of the ones of the current directory before the
+next prompt, and keeps them loaded whichever directory you change to until envy use --clear.`,
+	Args: cobra.MaximumNArgs(1),
+	ValidArgsFunction: func(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+		return nil, cobra.ShellCompDirectiveFilterDirs
+	},
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return genPreRun(cmd)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if useClear == (len(args) > 0) {
+			return errors.New("pass either a directory or --clear")
+		}
+
+		cmd.SilenceUsage = true
+
+		if useClear {
+			return useRun(cmd, "")
+		}
+
+		return useRun(cmd, args[0])
+	},
+}
+
+func init() {
+	useCmd.Flags().BoolVar(&useClear, "clear", false, "load the envy files of the current directory again")
+
+	rootCmd.AddCommand(useCmd)
+}
+
+// useRun pins the session to dir, or unpins it when dir is empty
+func useRun(cmd *cobra.Command, dir string) error {
+	sessionKey, _ := cmd.Context().Value("sessionKey").(string)
+
+	if len(os.Getenv("ENVY_STATELESS")) > 0 {
+		return errStateless
+	}
+
+	name := shared.SessionFilepath(sessionKey, "pinned")
+
+	if len(dir) == 0 {
+		err := os.Remove(name)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+
+		info, err := os.Stat(absDir)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", absDir)
+		}
+
+		err = writeLines([]string{absDir}, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	// make the hooks reload before the next prompt
+	err := os.Remove(shared.SessionFilepath(sessionKey, "checked"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// pinnedDir returns the directory pinned by envy use in the session, if any
+func pinnedDir(sessionKey string) string {
+	if len(sessionKey) == 0 {
+		return ""
+	}
+
+	content, err := os.ReadFile(shared.SessionFilepath(sessionKey, "pinned"))
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(content))
+}
+
+// sessionDir returns the directory the session loads the envy files of: the one pinned by envy use or dir
+func sessionDir(sessionKey string, dir string) string {
+	if pinned := pinnedDir(sessionKey); len(pinned) > 0 {
+		return pinned
+	}
+
+	return dir
+}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"envy/internal/app/shared"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUseRun(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("ENVY_STATELESS", "")
+
+	serviceDir := filepath.Join(tmp, "service")
+	os.Mkdir(serviceDir, 0755)
+
+	var searchedDirs []string
+
+	fake := &fakeShell{
+		findLoadPaths: func(dir string) []string {
+			searchedDirs = append(searchedDirs, dir)
+			return []string{filepath.Join(dir, "envy.sh")}
+		},
+		getSubshellCmd: func(_ []string) *exec.Cmd { return exec.Command("sh", "-c", "env") },
+		genLoadFile: func(paths []string) ([]string, string) {
+			return []string{}, filepath.Join(tmp, "session.load.sh")
+		},
+		genUndoFile: func(_ []shared.EnvChange) ([]string, string) {
+			return []string{}, filepath.Join(tmp, "session.undo.sh")
+		},
+	}
+
+	ctx := context.WithValue(context.Background(), "shell", fake)
+	ctx = context.WithValue(ctx, "sessionKey", "12345678")
+	useCmd.SetContext(ctx)
+	genCmd.SetContext(ctx)
+	statusCmd.SetContext(ctx)
+	genCmd.SetErr(io.Discard)
+	defer genCmd.SetErr(nil)
+
+	if err := useRun(useCmd, filepath.Join(tmp, "missing")); err == nil {
+		t.Error("useRun() expected an error for a missing directory")
+	}
+
+	if err := writeKey("key", shared.SessionFilepath("12345678", "checked")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := useRun(useCmd, serviceDir); err != nil {
+		t.Fatalf("useRun() unexpected error: %v", err)
+	}
+
+	if shared.Exists(shared.SessionFilepath("12345678", "checked")) {
+		t.Error("expected the hooks to reload after pinning a directory")
+	}
+
+	// gen loads the envy files of the pinned directory wherever it runs
+	searchedDirs = nil
+
+	if err := genRun(genCmd); err != nil {
+		t.Fatalf("genRun() unexpected error: %v", err)
+	}
+
+	if len(searchedDirs) != 1 || searchedDirs[0] != serviceDir {
+		t.Errorf("expected gen to search %s, searched %v", serviceDir, searchedDirs)
+	}
+
+	var buf bytes.Buffer
+
+	if err := statusRun(statusCmd, &buf, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(buf.String(), "pinned: "+serviceDir) || !strings.Contains(buf.String(), "dir: "+serviceDir) {
+		t.Errorf("expected the status to show the pin, got:\n%s", buf.String())
+	}
+
+	// --clear goes back to the current directory
+	if err := useRun(useCmd, ""); err != nil {
+		t.Fatalf("useRun() unexpected error: %v", err)
+	}
+
+	currentDir, _ := os.Getwd()
+	searchedDirs = nil
+
+	if err := genRun(genCmd); err != nil {
+		t.Fatalf("genRun() unexpected error: %v", err)
+	}
+
+	if len(searchedDirs) != 1 || searchedDirs[0] != currentDir {
+		t.Errorf("expected gen to search %s after clearing the pin, searched %v", currentDir, searchedDirs)
+	}
+}
+
+func TestUseCmd(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "no args", args: []string{"use"}},
+		{name: "dir and clear", args: []string{"use", ".", "--clear"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ENVY_SHELL", "zsh")
+			t.Setenv("ENVY_SESSION_KEY", "12345678")
+			t.Setenv("HOME", t.TempDir())
+
+			rootCmd.SetArgs(tt.args)
+			rootCmd.SetOut(io.Discard)
+			rootCmd.SetErr(io.Discard)
+			defer useCmd.Flags().Set("clear", "false")
+
+			if err := rootCmd.Execute(); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
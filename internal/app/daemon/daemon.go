@@ -0,0 +1,114 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"envy/internal/app/shared"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrUnavailable is returned by Eval when no daemon could be reached, in which case callers are expected
+// to evaluate in-process instead
+var ErrUnavailable = errors.New("daemon unavailable")
+
+var dialTimeout = 50 * time.Millisecond
+
+// how much longer than the evaluation timeout the client waits for the daemon to answer
+var requestTimeoutMargin = 5 * time.Second
+var defaultRequestTimeout = 30 * time.Second
+
+type Request struct {
+	Shell   string        `json:"shell"`
+	Dir     string        `json:"dir"`
+	Environ []string      `json:"environ"`
+	Paths   []string      `json:"paths"`
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// Refresh evaluates the paths again even when the environment is cached (e.g. for envy reload after a secret
+	// the files fetch was rotated)
+	Refresh bool `json:"refresh,omitempty"`
+}
+
+type Response struct {
+	Environ []string `json:"environ,omitempty"`
+	Error   string   `json:"error,omitempty"`
+	Path    string   `json:"path,omitempty"`
+}
+
+// RemoteError is an evaluation error reported by the daemon along with the file that failed (if known)
+type RemoteError struct {
+	Message string
+	Path    string
+}
+
+func (e *RemoteError) Error() string {
+	return e.Message
+}
+
+func (e *RemoteError) FailedPath() string {
+	return e.Path
+}
+
+// SocketPath returns the per-user socket in XDG_RUNTIME_DIR (falling back to the cache dir on systems
+// that don't have one)
+func SocketPath() string {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if len(runtimeDir) == 0 {
+		return filepath.Join(shared.CacheDir(), "daemon.sock")
+	}
+
+	return filepath.Join(runtimeDir, "envy", "daemon.sock")
+}
+
+// Eval sends the request to the daemon listening on socketPath and returns the evaluated env as
+// KEY=value lines; the connection is closed when ctx is done, which makes the daemon cancel the evaluation
+func Eval(ctx context.Context, socketPath string, request Request) ([]string, error) {
+	dialer := net.Dialer{Timeout: dialTimeout}
+
+	conn, err := dialer.DialContext(ctx, "unix", socketPath)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	timeout := request.Timeout
+	if timeout <= 0 {
+		timeout = defaultRequestTimeout
+	}
+
+	conn.SetDeadline(time.Now().Add(timeout + requestTimeoutMargin))
+
+	err = json.NewEncoder(conn).Encode(request)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	var response Response
+
+	err = json.NewDecoder(conn).Decode(&response)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	if len(response.Error) > 0 {
+		return nil, &RemoteError{Message: response.Error, Path: response.Path}
+	}
+
+	return response.Environ, nil
+}
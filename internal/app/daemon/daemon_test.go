@@ -0,0 +1,174 @@
+package daemon
+
+import (
+	"context"
+	"envy/internal/app/shell"
+	"errors"
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSocketPath(t *testing.T) {
+	tests := []struct {
+		name       string
+		runtimeDir string
+		expected   string
+	}{
+		{
+			name:       "runtime dir",
+			runtimeDir: "/run/user/1000",
+			expected:   "/run/user/1000/envy/daemon.sock",
+		},
+		{
+			name:       "no runtime dir",
+			runtimeDir: "",
+			expected:   "/home/test/.cache/envy/daemon.sock",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", "/home/test")
+			t.Setenv("XDG_RUNTIME_DIR", tt.runtimeDir)
+
+			if got := SocketPath(); got != tt.expected {
+				t.Errorf("SocketPath() = %s, want %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEval(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "daemon.sock")
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	server, err := NewServer(func(_ context.Context, request Request) ([]string, error) {
+		if len(request.Paths) == 0 {
+			return nil, errors.New("nothing to evaluate")
+		}
+
+		if request.Paths[0] == "/a/broken.sh" {
+			return nil, &shell.EvalError{Path: "/a/broken.sh", Line: 3, Message: "command not found: foo"}
+		}
+
+		return []string{"FOO=bar"}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	go server.Serve(listener)
+
+	tests := []struct {
+		name            string
+		socketPath      string
+		request         Request
+		want            []string
+		wantErr         bool
+		wantPath        string
+		wantUnavailable bool
+	}{
+		{
+			name:       "success",
+			socketPath: socketPath,
+			request:    Request{Shell: "test", Paths: []string{"/a/envy.sh"}},
+			want:       []string{"FOO=bar"},
+		},
+		{
+			name:       "evaluation error",
+			socketPath: socketPath,
+			request:    Request{Shell: "test"},
+			wantErr:    true,
+		},
+		{
+			name:       "evaluation error with the failing file",
+			socketPath: socketPath,
+			request:    Request{Shell: "test", Paths: []string{"/a/broken.sh"}},
+			wantErr:    true,
+			wantPath:   "/a/broken.sh",
+		},
+		{
+			name:            "no daemon",
+			socketPath:      filepath.Join(t.TempDir(), "missing.sock"),
+			request:         Request{Shell: "test"},
+			wantErr:         true,
+			wantUnavailable: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Eval(context.Background(), tt.socketPath, tt.request)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Eval() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got := shell.FailedPath(err); got != tt.wantPath {
+				t.Errorf("Eval() failed path = %q, want %q", got, tt.wantPath)
+			}
+
+			if errors.Is(err, ErrUnavailable) != tt.wantUnavailable {
+				t.Errorf("Eval() error = %v, wantUnavailable %v", err, tt.wantUnavailable)
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Eval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEval_Cancel(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "daemon.sock")
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+
+	// the evaluation only ends once the daemon cancels it
+	server, err := NewServer(func(ctx context.Context, request Request) ([]string, error) {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	go server.Serve(listener)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	_, err = Eval(ctx, socketPath, Request{Shell: "test", Timeout: time.Minute})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Eval() error = %v, want context.Canceled", err)
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Error("expected the daemon to cancel the evaluation once the client went away")
+	}
+}
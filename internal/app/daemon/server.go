@@ -0,0 +1,195 @@
+package daemon
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"envy/internal/app/shared"
+	"envy/internal/app/shell"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// the default maximum number of evaluated environments kept in memory
+var defaultMaxEntries = 64
+
+type EvalFunc func(ctx context.Context, request Request) ([]string, error)
+
+// watcher reports changes to the load paths it was asked to watch
+type watcher interface {
+	Add(path string) error
+	Close() error
+}
+
+type entry struct {
+	request Request
+	environ []string
+}
+
+type Server struct {
+	eval       EvalFunc
+	watcher    watcher
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	// keys in insertion order so the oldest entry can be evicted first
+	keys []string
+}
+
+func NewServer(eval EvalFunc) (*Server, error) {
+	s := &Server{
+		eval:       eval,
+		maxEntries: defaultMaxEntries,
+		entries:    make(map[string]*entry),
+	}
+
+	w, err := newWatcher(s.changed)
+	if err != nil {
+		return nil, err
+	}
+
+	s.watcher = w
+
+	return s, nil
+}
+
+func (s *Server) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) Close() error {
+	return s.watcher.Close()
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	var request Request
+
+	err := json.NewDecoder(conn).Decode(&request)
+	if err != nil {
+		return
+	}
+
+	// clients send nothing after the request, so the connection only ends before the answer is written when the
+	// client gave up (e.g. gen was interrupted) and there is no point in finishing the evaluation
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		buf := make([]byte, 1)
+		for {
+			if _, err := conn.Read(buf); err != nil {
+				cancel()
+				return
+			}
+		}
+	}()
+
+	var response Response
+
+	response.Environ, err = s.Eval(ctx, request)
+	if err != nil {
+		response.Error = err.Error()
+		response.Path = shell.FailedPath(err)
+	}
+
+	json.NewEncoder(conn).Encode(response)
+}
+
+// Eval returns the cached environment for the request (unless it asks for a refresh) or evaluates (and caches) it
+func (s *Server) Eval(ctx context.Context, request Request) ([]string, error) {
+	key := requestKey(request)
+
+	s.mu.Lock()
+	cached, ok := s.entries[key]
+	s.mu.Unlock()
+
+	if ok && !request.Refresh {
+		return cached.environ, nil
+	}
+
+	environ, err := s.eval(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	s.store(key, &entry{request: request, environ: environ})
+
+	for _, path := range request.Paths {
+		s.watcher.Add(path)
+	}
+
+	return environ, nil
+}
+
+func (s *Server) store(key string, e *entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.entries[key]; !ok {
+		s.keys = append(s.keys, key)
+	}
+
+	s.entries[key] = e
+
+	for len(s.keys) > s.maxEntries {
+		delete(s.entries, s.keys[0])
+		s.keys = s.keys[1:]
+	}
+}
+
+// changed drops every entry that depends on path and evaluates them again in the background so they are
+// warm by the time a shell asks for them
+func (s *Server) changed(path string) {
+	var stale []Request
+
+	s.mu.Lock()
+	for key, e := range s.entries {
+		if slices.Contains(e.request.Paths, path) {
+			stale = append(stale, e.request)
+
+			delete(s.entries, key)
+			s.keys = slices.DeleteFunc(s.keys, func(k string) bool { return k == key })
+		}
+	}
+	s.mu.Unlock()
+
+	for _, request := range stale {
+		go s.Eval(context.Background(), request)
+	}
+}
+
+// requestKey identifies a request by everything that can influence the evaluated environment, including
+// the stamps of the load paths so an entry can never be served after a file changed (even when the
+// watcher missed it or isn't supported on this platform)
+func requestKey(request Request) string {
+	hash := sha256.New()
+
+	fmt.Fprintf(hash, "%s\x00%s\x00%s\n", request.Shell, request.Dir, shared.LoadPathsKey(request.Paths))
+
+	// vars that change on every prompt or cd and that envy doesn't track would make every key unique
+	environ := slices.DeleteFunc(slices.Clone(request.Environ), func(line string) bool {
+		key, _, _ := strings.Cut(line, "=")
+		return slices.Contains(shared.UntrackedEnvVars, key)
+	})
+	slices.Sort(environ)
+
+	for _, line := range environ {
+		fmt.Fprintf(hash, "%s\x00", line)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,144 @@
+package daemon
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestServer_Eval(t *testing.T) {
+	tmp := t.TempDir()
+
+	path := filepath.Join(tmp, "envy.sh")
+	if err := os.WriteFile(path, []byte("export FOO=bar"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var evals atomic.Int32
+
+	server, err := NewServer(func(_ context.Context, request Request) ([]string, error) {
+		evals.Add(1)
+		return []string{"FOO=bar"}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	request := Request{Shell: "test", Dir: tmp, Environ: []string{"HOME=/home/test", "OLDPWD=/a"}, Paths: []string{path}}
+
+	if _, err := server.Eval(context.Background(), request); err != nil {
+		t.Fatalf("Eval() unexpected error: %v", err)
+	}
+
+	// untracked vars such as OLDPWD don't prevent a cache hit
+	request.Environ = []string{"HOME=/home/test", "OLDPWD=/b"}
+
+	if _, err := server.Eval(context.Background(), request); err != nil {
+		t.Fatalf("Eval() unexpected error: %v", err)
+	}
+
+	if evals.Load() != 1 {
+		t.Errorf("expected 1 evaluation for repeated requests, got %d", evals.Load())
+	}
+
+	// tracked vars are part of the key
+	request.Environ = []string{"HOME=/home/other"}
+
+	if _, err := server.Eval(context.Background(), request); err != nil {
+		t.Fatalf("Eval() unexpected error: %v", err)
+	}
+
+	if evals.Load() != 2 {
+		t.Errorf("expected 2 evaluations after changing the environ, got %d", evals.Load())
+	}
+
+	// a refresh evaluates again even though the entry is cached
+	request.Refresh = true
+
+	if _, err := server.Eval(context.Background(), request); err != nil {
+		t.Fatalf("Eval() unexpected error: %v", err)
+	}
+
+	if evals.Load() != 3 {
+		t.Errorf("expected 3 evaluations after a refresh, got %d", evals.Load())
+	}
+}
+
+func TestServer_Changed(t *testing.T) {
+	tmp := t.TempDir()
+
+	path := filepath.Join(tmp, "envy.sh")
+	if err := os.WriteFile(path, []byte("export FOO=bar"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var evals atomic.Int32
+
+	server, err := NewServer(func(_ context.Context, request Request) ([]string, error) {
+		evals.Add(1)
+		return []string{"FOO=bar"}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	request := Request{Shell: "test", Dir: tmp, Paths: []string{path}}
+
+	if _, err := server.Eval(context.Background(), request); err != nil {
+		t.Fatalf("Eval() unexpected error: %v", err)
+	}
+
+	// a change drops the entry and evaluates it again in the background
+	server.changed(path)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for evals.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if evals.Load() < 2 {
+		t.Fatalf("expected the changed entry to be evaluated again, got %d evaluations", evals.Load())
+	}
+
+	// unrelated paths don't affect the entry
+	server.changed(filepath.Join(tmp, "other.sh"))
+
+	server.mu.Lock()
+	entries := len(server.entries)
+	server.mu.Unlock()
+
+	if entries != 1 {
+		t.Errorf("expected 1 entry, got %d", entries)
+	}
+}
+
+func TestServer_Evict(t *testing.T) {
+	server, err := NewServer(func(_ context.Context, request Request) ([]string, error) {
+		return []string{}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	server.maxEntries = 2
+
+	for _, dir := range []string{"/a", "/b", "/c"} {
+		if _, err := server.Eval(context.Background(), Request{Shell: "test", Dir: dir}); err != nil {
+			t.Fatalf("Eval() unexpected error: %v", err)
+		}
+	}
+
+	if len(server.entries) != 2 || len(server.keys) != 2 {
+		t.Fatalf("expected 2 entries, got %d entries and %d keys", len(server.entries), len(server.keys))
+	}
+
+	if _, ok := server.entries[requestKey(Request{Shell: "test", Dir: "/a"})]; ok {
+		t.Error("expected the oldest entry to be evicted")
+	}
+}
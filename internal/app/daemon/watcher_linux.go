@@ -0,0 +1,104 @@
+//go:build linux
+
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// the parent directory is watched instead of the file itself because editors commonly save by writing a
+// new file and renaming it over the old one which would silently end a watch on the file
+const watchMask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_MOVED_FROM | syscall.IN_CREATE | syscall.IN_DELETE
+
+type inotifyWatcher struct {
+	fd int
+	// reading through an *os.File uses the runtime poller so Close reliably ends the read loop (a plain
+	// blocking read could outlive Close and steal events from a new watcher that reuses the fd)
+	file     *os.File
+	onChange func(path string)
+
+	mu   sync.Mutex
+	dirs map[string]int
+	wds  map[int]string
+}
+
+func newWatcher(onChange func(path string)) (watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &inotifyWatcher{
+		fd:       fd,
+		file:     os.NewFile(uintptr(fd), "inotify"),
+		onChange: onChange,
+		dirs:     make(map[string]int),
+		wds:      make(map[int]string),
+	}
+
+	go w.run()
+
+	return w, nil
+}
+
+func (w *inotifyWatcher) Add(path string) error {
+	dir := filepath.Dir(path)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.dirs[dir]; ok {
+		return nil
+	}
+
+	wd, err := syscall.InotifyAddWatch(w.fd, dir, watchMask)
+	if err != nil {
+		return err
+	}
+
+	w.dirs[dir] = wd
+	w.wds[wd] = dir
+
+	return nil
+}
+
+func (w *inotifyWatcher) Close() error {
+	return w.file.Close()
+}
+
+func (w *inotifyWatcher) run() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil || n <= 0 {
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameBytes := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(event.Len)]
+			offset += syscall.SizeofInotifyEvent + int(event.Len)
+
+			w.mu.Lock()
+			dir, ok := w.wds[int(event.Wd)]
+			w.mu.Unlock()
+
+			if !ok {
+				continue
+			}
+
+			// the name is padded with NUL bytes up to event.Len
+			name := string(nameBytes)
+			for len(name) > 0 && name[len(name)-1] == 0 {
+				name = name[:len(name)-1]
+			}
+
+			w.onChange(filepath.Join(dir, name))
+		}
+	}
+}
@@ -0,0 +1,49 @@
+//go:build linux
+
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInotifyWatcher(t *testing.T) {
+	tmp := t.TempDir()
+
+	path := filepath.Join(tmp, "envy.sh")
+	if err := os.WriteFile(path, []byte("export FOO=bar"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	changes := make(chan string, 16)
+
+	w, err := newWatcher(func(path string) { changes <- path })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if err := w.Add(path); err != nil {
+		t.Fatalf("Add() unexpected error: %v", err)
+	}
+
+	// adding a second path in the same dir reuses the existing watch
+	if err := w.Add(filepath.Join(tmp, "other.sh")); err != nil {
+		t.Fatalf("Add() unexpected error: %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("export FOO=baz"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case got := <-changes:
+		if got != path {
+			t.Errorf("expected change for %s, got %s", path, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a change")
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package daemon
+
+// pollWatcher doesn't watch anything; entries are still never served stale because the request key
+// includes the modification times of the load paths
+type pollWatcher struct{}
+
+func newWatcher(_ func(path string)) (watcher, error) {
+	return pollWatcher{}, nil
+}
+
+func (pollWatcher) Add(_ string) error {
+	return nil
+}
+
+func (pollWatcher) Close() error {
+	return nil
+}
@@ -0,0 +1,517 @@
+package posix
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrUnsupported is returned when a file uses syntax outside the subset understood by this package, in
+// which case the file must be evaluated by a real shell instead
+var ErrUnsupported = errors.New("unsupported syntax")
+
+type Script struct {
+	Path       string
+	statements []statement
+}
+
+type statement struct {
+	export      bool
+	assignments []assignment
+	names       []string
+}
+
+type assignment struct {
+	name  string
+	value word
+}
+
+type word []part
+
+// part is either a literal or a parameter expansion
+type part struct {
+	literal string
+	param   *param
+}
+
+type param struct {
+	name string
+	// one of "", ":-", "-", ":=", "=", ":+" or "+"
+	op   string
+	word word
+}
+
+var paramOps = []string{":-", ":=", ":+", "-", "=", "+"}
+
+// characters that mean something to the shell when unquoted and therefore aren't supported
+var unquotedSpecials = "`|&;<>(){}*?[]!^~"
+
+func ParseFile(path string) (*Script, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	script := &Script{Path: path}
+
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		stmt, err := parseLine(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNumber, err)
+		}
+
+		if stmt != nil {
+			script.statements = append(script.statements, *stmt)
+		}
+	}
+
+	return script, scanner.Err()
+}
+
+// Eval parses every path and evaluates them in order on top of environ (KEY=value lines) as if they
+// were sourced by a shell started in dir, returning the exported variables as KEY=value lines. Nothing
+// is evaluated unless every file is within the supported subset.
+func Eval(paths []string, environ []string, dir string) ([]string, error) {
+	var scripts []*Script
+
+	for _, path := range paths {
+		script, err := ParseFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		scripts = append(scripts, script)
+	}
+
+	vars := make(map[string]string)
+	exported := make(map[string]bool)
+
+	for _, line := range environ {
+		if key, value, found := strings.Cut(line, "="); found {
+			vars[key] = value
+			exported[key] = true
+		}
+	}
+
+	// a shell started in dir would see it as its working directory
+	if len(dir) > 0 {
+		vars["PWD"] = dir
+	}
+
+	for _, script := range scripts {
+		script.exec(vars, exported)
+	}
+
+	var lines []string
+
+	for key := range exported {
+		lines = append(lines, fmt.Sprintf("%s=%s", key, vars[key]))
+	}
+
+	return lines, nil
+}
+
+func (s *Script) exec(vars map[string]string, exported map[string]bool) {
+	for _, stmt := range s.statements {
+		// assignments are applied left to right so later ones see earlier ones
+		for _, a := range stmt.assignments {
+			vars[a.name] = a.value.expand(vars)
+
+			if stmt.export {
+				exported[a.name] = true
+			}
+		}
+
+		for _, name := range stmt.names {
+			// zsh creates an empty parameter when exporting one that isn't set
+			if _, isSet := vars[name]; !isSet {
+				vars[name] = ""
+			}
+
+			exported[name] = true
+		}
+	}
+}
+
+func (w word) expand(vars map[string]string) string {
+	var sb strings.Builder
+
+	for _, p := range w {
+		if p.param == nil {
+			sb.WriteString(p.literal)
+		} else {
+			sb.WriteString(p.param.expand(vars))
+		}
+	}
+
+	return sb.String()
+}
+
+func (w word) references(name string) bool {
+	for _, p := range w {
+		if p.param != nil && (p.param.name == name || p.param.word.references(name)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *param) expand(vars map[string]string) string {
+	value, isSet := vars[p.name]
+	isNull := !isSet || len(value) == 0
+
+	switch p.op {
+	case ":-":
+		if isNull {
+			return p.word.expand(vars)
+		}
+	case "-":
+		if !isSet {
+			return p.word.expand(vars)
+		}
+	case ":=":
+		if isNull {
+			vars[p.name] = p.word.expand(vars)
+			return vars[p.name]
+		}
+	case "=":
+		if !isSet {
+			vars[p.name] = p.word.expand(vars)
+			return vars[p.name]
+		}
+	case ":+":
+		if isNull {
+			return ""
+		}
+		return p.word.expand(vars)
+	case "+":
+		if !isSet {
+			return ""
+		}
+		return p.word.expand(vars)
+	}
+
+	return value
+}
+
+type lineParser struct {
+	line string
+	pos  int
+}
+
+func parseLine(line string) (*statement, error) {
+	p := &lineParser{line: line}
+
+	var words []string
+	var stmt statement
+
+	for {
+		p.skipBlanks()
+
+		if p.done() || p.peek() == '#' {
+			break
+		}
+
+		start := p.pos
+		if err := p.skipWord(); err != nil {
+			return nil, err
+		}
+
+		words = append(words, line[start:p.pos])
+	}
+
+	if len(words) == 0 {
+		return nil, nil
+	}
+
+	args := words
+	if words[0] == "export" {
+		stmt.export = true
+		args = words[1:]
+	}
+
+	for _, raw := range args {
+		name, value, isAssignment := strings.Cut(raw, "=")
+
+		if !isName(name) {
+			return nil, fmt.Errorf("%w: %q is not an assignment", ErrUnsupported, raw)
+		}
+
+		if !isAssignment {
+			// bare names are only meaningful as arguments to export
+			if !stmt.export {
+				return nil, fmt.Errorf("%w: %q is a command", ErrUnsupported, raw)
+			}
+
+			stmt.names = append(stmt.names, name)
+			continue
+		}
+
+		w, err := parseWord(value)
+		if err != nil {
+			return nil, err
+		}
+
+		// shells disagree on whether export arguments see each other so don't guess
+		for _, a := range stmt.assignments {
+			if stmt.export && w.references(a.name) {
+				return nil, fmt.Errorf("%w: export of %s references %s from the same line", ErrUnsupported, name, a.name)
+			}
+		}
+
+		stmt.assignments = append(stmt.assignments, assignment{name: name, value: w})
+	}
+
+	// "export" on its own lists the exported variables
+	if len(stmt.assignments) == 0 && len(stmt.names) == 0 {
+		return nil, fmt.Errorf("%w: export without arguments", ErrUnsupported)
+	}
+
+	return &stmt, nil
+}
+
+func (p *lineParser) done() bool {
+	return p.pos >= len(p.line)
+}
+
+func (p *lineParser) peek() byte {
+	return p.line[p.pos]
+}
+
+func (p *lineParser) skipBlanks() {
+	for !p.done() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.pos++
+	}
+}
+
+// skipWord moves past a single word honouring quotes and ${...} so that blanks inside them don't end it
+func (p *lineParser) skipWord() error {
+	depth := 0
+
+	for !p.done() {
+		c := p.peek()
+
+		switch {
+		case (c == ' ' || c == '\t') && depth == 0:
+			return nil
+		case c == '\\':
+			p.pos += 2
+		case c == '\'':
+			end := strings.IndexByte(p.line[p.pos+1:], '\'')
+			if end < 0 {
+				return fmt.Errorf("%w: unterminated single quote", ErrUnsupported)
+			}
+			p.pos += end + 2
+		case c == '"':
+			p.pos++
+			for !p.done() && p.peek() != '"' {
+				if p.peek() == '\\' {
+					p.pos++
+				}
+				p.pos++
+			}
+			if p.done() {
+				return fmt.Errorf("%w: unterminated double quote", ErrUnsupported)
+			}
+			p.pos++
+		case c == '$' && p.pos+1 < len(p.line) && p.line[p.pos+1] == '{':
+			depth++
+			p.pos += 2
+		case c == '}' && depth > 0:
+			depth--
+			p.pos++
+		default:
+			p.pos++
+		}
+	}
+
+	if p.pos > len(p.line) {
+		return fmt.Errorf("%w: line continuation", ErrUnsupported)
+	}
+
+	if depth > 0 {
+		return fmt.Errorf("%w: unterminated parameter expansion", ErrUnsupported)
+	}
+
+	return nil
+}
+
+// parseWord parses the value of an assignment
+func parseWord(s string) (word, error) {
+	var w word
+
+	// a leading tilde expands to the home directory
+	if s == "~" || strings.HasPrefix(s, "~/") {
+		w = append(w, part{param: &param{name: "HOME"}})
+		s = s[1:]
+	}
+
+	if strings.HasPrefix(s, "=") {
+		return nil, fmt.Errorf("%w: leading = expansion", ErrUnsupported)
+	}
+
+	rest, err := parseParts(s, &w, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrUnsupported, rest)
+	}
+
+	return w, nil
+}
+
+// parseParts appends the parts found in s to w until the end of s, an unquoted closing brace (when
+// inBraces) or a closing double quote (when inQuotes), returning whatever is left of s
+func parseParts(s string, w *word, inQuotes bool, inBraces bool) (string, error) {
+	var literal strings.Builder
+
+	flush := func() {
+		if literal.Len() > 0 {
+			*w = append(*w, part{literal: literal.String()})
+			literal.Reset()
+		}
+	}
+
+	for len(s) > 0 {
+		c := s[0]
+
+		switch {
+		case inQuotes && c == '"':
+			flush()
+			return s, nil
+		case !inQuotes && inBraces && c == '}':
+			flush()
+			return s, nil
+		case c == '\\':
+			if len(s) < 2 {
+				return "", fmt.Errorf("%w: trailing backslash", ErrUnsupported)
+			}
+			// inside double quotes a backslash only escapes characters that are special there
+			if inQuotes && !strings.ContainsRune("$`\"\\", rune(s[1])) {
+				literal.WriteByte('\\')
+			}
+			literal.WriteByte(s[1])
+			s = s[2:]
+		case c == '`':
+			return "", fmt.Errorf("%w: command substitution", ErrUnsupported)
+		case c == '$':
+			flush()
+			rest, err := parseParam(s, w)
+			if err != nil {
+				return "", err
+			}
+			s = rest
+		case !inQuotes && c == '\'':
+			end := strings.IndexByte(s[1:], '\'')
+			if end < 0 {
+				return "", fmt.Errorf("%w: unterminated single quote", ErrUnsupported)
+			}
+			literal.WriteString(s[1 : end+1])
+			s = s[end+2:]
+		case !inQuotes && c == '"':
+			flush()
+			rest, err := parseParts(s[1:], w, true, false)
+			if err != nil {
+				return "", err
+			}
+			if len(rest) == 0 {
+				return "", fmt.Errorf("%w: unterminated double quote", ErrUnsupported)
+			}
+			s = rest[1:]
+		case !inQuotes && strings.IndexByte(unquotedSpecials, c) >= 0:
+			return "", fmt.Errorf("%w: unquoted %q", ErrUnsupported, c)
+		default:
+			literal.WriteByte(c)
+			s = s[1:]
+		}
+	}
+
+	flush()
+
+	return s, nil
+}
+
+// parseParam parses a $NAME, ${NAME} or ${NAME<op>word} expansion at the start of s
+func parseParam(s string, w *word) (string, error) {
+	s = s[1:]
+
+	if !strings.HasPrefix(s, "{") {
+		n := nameLength(s)
+		if n == 0 {
+			return "", fmt.Errorf("%w: special parameter or substitution", ErrUnsupported)
+		}
+
+		// zsh applies a modifier ($X:l) or a subscript ($X[1]) following an unbraced name, which this package
+		// would keep as literal text
+		if n < len(s) && (s[n] == ':' || s[n] == '[') {
+			return "", fmt.Errorf("%w: modifier or subscript after $%s", ErrUnsupported, s[:n])
+		}
+
+		*w = append(*w, part{param: &param{name: s[:n]}})
+
+		return s[n:], nil
+	}
+
+	s = s[1:]
+
+	n := nameLength(s)
+	if n == 0 {
+		return "", fmt.Errorf("%w: parameter expansion flags or special parameter", ErrUnsupported)
+	}
+
+	p := &param{name: s[:n]}
+	s = s[n:]
+
+	if !strings.HasPrefix(s, "}") {
+		for _, op := range paramOps {
+			if strings.HasPrefix(s, op) {
+				p.op = op
+				break
+			}
+		}
+
+		if len(p.op) == 0 {
+			return "", fmt.Errorf("%w: parameter expansion operator", ErrUnsupported)
+		}
+
+		rest, err := parseParts(s[len(p.op):], &p.word, false, true)
+		if err != nil {
+			return "", err
+		}
+
+		s = rest
+	}
+
+	if !strings.HasPrefix(s, "}") {
+		return "", fmt.Errorf("%w: unterminated parameter expansion", ErrUnsupported)
+	}
+
+	*w = append(*w, part{param: p})
+
+	return s[1:], nil
+}
+
+func nameLength(s string) int {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		isAlpha := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		isDigit := c >= '0' && c <= '9'
+
+		if !isAlpha && (!isDigit || i == 0) {
+			return i
+		}
+	}
+
+	return len(s)
+}
+
+func isName(s string) bool {
+	return len(s) > 0 && nameLength(s) == len(s)
+}
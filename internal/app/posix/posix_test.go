@@ -0,0 +1,212 @@
+package posix
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name            string
+		line            string
+		wantStatement   bool
+		wantUnsupported bool
+	}{
+		{name: "blank", line: "   ", wantStatement: false},
+		{name: "comment", line: "# export FOO=bar", wantStatement: false},
+		{name: "indented comment", line: "\t# comment", wantStatement: false},
+		{name: "export", line: "export FOO=bar", wantStatement: true},
+		{name: "export bare name", line: "export FOO", wantStatement: true},
+		{name: "export multiple", line: "export FOO=bar BAZ=qux", wantStatement: true},
+		{name: "assignment", line: "FOO=bar", wantStatement: true},
+		{name: "trailing comment", line: "FOO=bar # comment", wantStatement: true},
+		{name: "quoted blanks", line: `export FOO="bar baz" QUX='a b'`, wantStatement: true},
+		{name: "expansion with blanks", line: "export FOO=${BAR:-a b}", wantStatement: true},
+		{name: "tilde", line: "export FOO=~/bin", wantStatement: true},
+		{name: "command", line: "echo hello", wantUnsupported: true},
+		{name: "source", line: ". ./other.sh", wantUnsupported: true},
+		{name: "assignment prefix", line: "FOO=bar cmd", wantUnsupported: true},
+		{name: "export flag", line: "export -p", wantUnsupported: true},
+		{name: "export only", line: "export", wantUnsupported: true},
+		{name: "command substitution", line: "export FOO=$(whoami)", wantUnsupported: true},
+		{name: "quoted command substitution", line: `export FOO="$(whoami)"`, wantUnsupported: true},
+		{name: "backticks", line: "export FOO=`whoami`", wantUnsupported: true},
+		{name: "semicolon", line: "export FOO=bar; export BAZ=qux", wantUnsupported: true},
+		{name: "pipe", line: "FOO=bar | cat", wantUnsupported: true},
+		{name: "glob", line: "export FOO=*.txt", wantUnsupported: true},
+		{name: "special parameter", line: "export FOO=$1", wantUnsupported: true},
+		{name: "colon after name", line: "PATH=$HOME:/bin", wantUnsupported: true},
+		{name: "modifier", line: "export CLASSPATH=$JAVA_HOME:l", wantUnsupported: true},
+		{name: "quoted modifier", line: `export T="$JAVA_HOME:t"`, wantUnsupported: true},
+		{name: "subscript", line: "export FIRST=$X[1]", wantUnsupported: true},
+		{name: "quoted subscript", line: `export FIRST="$X[1]"`, wantUnsupported: true},
+		{name: "pattern removal", line: "export FOO=${BAR%.txt}", wantUnsupported: true},
+		{name: "zsh flags", line: "export FOO=${(U)BAR}", wantUnsupported: true},
+		{name: "unterminated quote", line: `export FOO="bar`, wantUnsupported: true},
+		{name: "line continuation", line: `export FOO=bar \`, wantUnsupported: true},
+		{name: "tilde user", line: "export FOO=~root/bin", wantUnsupported: true},
+		{name: "export referencing same line", line: "export FOO=bar BAZ=$FOO", wantUnsupported: true},
+		{name: "nested quotes with blanks", line: `export FOO="${BAR:-"a b"}"`, wantUnsupported: true},
+		{name: "if", line: "if [[ -n $FOO ]]; then", wantUnsupported: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, err := parseLine(tt.line)
+
+			if tt.wantUnsupported {
+				if !errors.Is(err, ErrUnsupported) {
+					t.Errorf("parseLine(%q) error = %v, want ErrUnsupported", tt.line, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("parseLine(%q) unexpected error: %v", tt.line, err)
+			}
+
+			if (stmt != nil) != tt.wantStatement {
+				t.Errorf("parseLine(%q) statement = %v, wantStatement %v", tt.line, stmt, tt.wantStatement)
+			}
+		})
+	}
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []string
+		environ []string
+		dir     string
+		want    []string
+	}{
+		{
+			name:    "export and reference",
+			files:   []string{"export FOO=bar\nexport PATH=${PATH}:/opt/bin"},
+			environ: []string{"PATH=/usr/bin"},
+			want:    []string{"FOO=bar", "PATH=/usr/bin:/opt/bin"},
+		},
+		{
+			name:  "unexported assignment",
+			files: []string{"BASE=/opt\nexport FOO=${BASE}/bin"},
+			want:  []string{"FOO=/opt/bin"},
+		},
+		{
+			name:    "assignment to an exported variable stays exported",
+			files:   []string{"FOO=changed"},
+			environ: []string{"FOO=original"},
+			want:    []string{"FOO=changed"},
+		},
+		{
+			name:  "export after assignment",
+			files: []string{"FOO=bar\nexport FOO"},
+			want:  []string{"FOO=bar"},
+		},
+		{
+			name:  "export unset name",
+			files: []string{"export FOO"},
+			want:  []string{"FOO="},
+		},
+		{
+			name:    "defaults",
+			files:   []string{`export A=${UNSET:-a} B=${EMPTY:-b} C=${EMPTY-c} D=${SET:+d} E=${UNSET+e}`},
+			environ: []string{"EMPTY=", "SET=x"},
+			want:    []string{"A=a", "B=b", "C=", "D=d", "E=", "EMPTY=", "SET=x"},
+		},
+		{
+			name:  "assign default",
+			files: []string{"export FOO=${BAR:=bar}\nexport BAR"},
+			want:  []string{"BAR=bar", "FOO=bar"},
+		},
+		{
+			name:    "quoting",
+			files:   []string{`export A='$HOME "x"' B="$HOME 'x' \$y \n" C=a\ b D="${MISSING:-"nested"} value"`},
+			environ: []string{"HOME=/home/test"},
+			want:    []string{`A=$HOME "x"`, `B=/home/test 'x' $y \n`, "C=a b", "D=nested value", "HOME=/home/test"},
+		},
+		{
+			name:    "tilde",
+			files:   []string{"export FOO=~/bin"},
+			environ: []string{"HOME=/home/test"},
+			want:    []string{"FOO=/home/test/bin", "HOME=/home/test"},
+		},
+		{
+			name:  "multiple files in order",
+			files: []string{"export FOO=parent", "export FOO=$FOO-child"},
+			want:  []string{"FOO=parent-child"},
+		},
+		{
+			name:  "working directory",
+			files: []string{"export PROJECT=$PWD"},
+			dir:   "/projects/app",
+			want:  []string{"PROJECT=/projects/app"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := t.TempDir()
+
+			var paths []string
+
+			for i, content := range tt.files {
+				path := filepath.Join(tmp, string(rune('a'+i))+".sh")
+				if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+
+				paths = append(paths, path)
+			}
+
+			got, err := Eval(paths, tt.environ, tt.dir)
+			if err != nil {
+				t.Fatalf("Eval() unexpected error: %v", err)
+			}
+
+			slices.Sort(got)
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Eval() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEval_Unsupported(t *testing.T) {
+	tmp := t.TempDir()
+
+	simple := filepath.Join(tmp, "simple.sh")
+	complex := filepath.Join(tmp, "complex.sh")
+
+	if err := os.WriteFile(simple, []byte("export FOO=bar\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(complex, []byte("export FOO=bar\nexport TOKEN=$(vault read token)\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Eval([]string{simple, complex}, nil, "")
+
+	if !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Eval() error = %v, want ErrUnsupported", err)
+	}
+
+	// the error points at the offending file and line
+	want := complex + ":2: "
+	if !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("Eval() error = %q, want prefix %q", err.Error(), want)
+	}
+}
+
+func TestEval_MissingFile(t *testing.T) {
+	_, err := Eval([]string{filepath.Join(t.TempDir(), "missing.sh")}, nil, "")
+
+	if err == nil || errors.Is(err, ErrUnsupported) {
+		t.Errorf("Eval() error = %v, want a file error", err)
+	}
+}
@@ -0,0 +1,38 @@
+package shared
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+func CacheDir() string {
+	homeDir, _ := os.UserHomeDir()
+
+	return filepath.Join(homeDir, ".cache", "envy")
+}
+
+// SessionFilepath returns the path of a session specific file in the cache dir (e.g. <session>.load.sh)
+func SessionFilepath(sessionKey string, suffix string) string {
+	return filepath.Join(CacheDir(), fmt.Sprintf("%s.%s", sessionKey, suffix))
+}
+
+// LoadPathsKey identifies a set of load paths along with their modification times and sizes so that
+// any added, removed, reordered or edited file results in a different key
+func LoadPathsKey(paths []string) string {
+	hash := sha256.New()
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			fmt.Fprintf(hash, "%s\x00missing\n", path)
+			continue
+		}
+
+		fmt.Fprintf(hash, "%s\x00%d\x00%d\n", path, info.ModTime().UnixNano(), info.Size())
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
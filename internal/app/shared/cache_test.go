@@ -0,0 +1,61 @@
+package shared
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCacheDir(t *testing.T) {
+	t.Setenv("HOME", "/home/test")
+
+	expected := filepath.Join("/home/test", ".cache", "envy")
+
+	if got := CacheDir(); got != expected {
+		t.Errorf("CacheDir() = %s, want %s", got, expected)
+	}
+}
+
+func TestSessionFilepath(t *testing.T) {
+	t.Setenv("HOME", "/home/test")
+
+	expected := filepath.Join("/home/test", ".cache", "envy", "12345678.load.sh")
+
+	if got := SessionFilepath("12345678", "load.sh"); got != expected {
+		t.Errorf("SessionFilepath() = %s, want %s", got, expected)
+	}
+}
+
+func TestLoadPathsKey(t *testing.T) {
+	tmp := t.TempDir()
+
+	a := filepath.Join(tmp, "a.sh")
+	b := filepath.Join(tmp, "b.sh")
+
+	for _, file := range []string{a, b} {
+		if err := os.WriteFile(file, []byte(""), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if LoadPathsKey([]string{a, b}) != LoadPathsKey([]string{a, b}) {
+		t.Error("expected the same key for the same unchanged paths")
+	}
+
+	if LoadPathsKey([]string{a, b}) == LoadPathsKey([]string{b, a}) {
+		t.Error("expected a different key when the order changes")
+	}
+
+	if LoadPathsKey([]string{a}) == LoadPathsKey([]string{a, b}) {
+		t.Error("expected a different key when a path is added")
+	}
+
+	before := LoadPathsKey([]string{a})
+	if err := os.WriteFile(a, []byte("export FOO=bar"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if LoadPathsKey([]string{a}) == before {
+		t.Error("expected a different key after a path is modified")
+	}
+}
@@ -1,18 +1,38 @@
 package shared
 
 import (
+	"maps"
 	"os"
 	"path/filepath"
 	"slices"
 	"strings"
 )
 
-var UntrackedEnvVars = []string{"_", "OLDPWD", "SHLVL", "TTY"}
+var UntrackedEnvVars = []string{"_", "OLDPWD", "SHLVL", "TTY", "ENVY_STATE"}
+
+// ShellEnvVars are kept up to date by the shell itself (e.g. PWD follows cd) so they are never restored from a
+// baseline either
+var ShellEnvVars = []string{"PWD", "COLUMNS", "LINES"}
+
+// SessionEnvVars are set by init for the session itself so they are never restored from a baseline
+var SessionEnvVars = []string{"ENVY_SHELL", "ENVY_SESSION_KEY", "ENVY_SESSION_PID"}
 
 type EnvChange struct {
-	Key      string
-	OldValue string
-	NewValue string
+	Key      string `json:"key"`
+	OldValue string `json:"oldValue,omitempty"`
+	NewValue string `json:"newValue,omitempty"`
+}
+
+// Sign returns + for an added key, - for a removed one and ~ for a changed one
+func (c EnvChange) Sign() string {
+	switch {
+	case len(c.OldValue) == 0:
+		return "+"
+	case len(c.NewValue) == 0:
+		return "-"
+	}
+
+	return "~"
 }
 
 type Env struct {
@@ -42,6 +62,21 @@ func NewEnv(lines []string) *Env {
 	}
 }
 
+func (e *Env) Vars() map[string]string {
+	return maps.Clone(e.vars)
+}
+
+// Environ returns the vars as sorted KEY=value lines (the same shape as os.Environ)
+func (e *Env) Environ() []string {
+	var lines []string
+
+	for _, key := range slices.Sorted(maps.Keys(e.vars)) {
+		lines = append(lines, key+"="+e.vars[key])
+	}
+
+	return lines
+}
+
 func (old *Env) Diff(new *Env) []EnvChange {
 	var changes []EnvChange
 
@@ -63,18 +98,138 @@ func (old *Env) Diff(new *Env) []EnvChange {
 	return changes
 }
 
-func FindLoadPaths(filename string) []string {
-	var paths []string
+// ComposeChanges combines changes applied one after the other into a single change per key (from the value
+// before the first change to the value after the last), sorted by key
+func ComposeChanges(changeSets ...[]EnvChange) []EnvChange {
+	composed := make(map[string]EnvChange)
 
-	currentDir, _ := os.Getwd()
+	for _, changes := range changeSets {
+		for _, change := range changes {
+			if previous, ok := composed[change.Key]; ok {
+				change.OldValue = previous.OldValue
+			}
+
+			composed[change.Key] = change
+		}
+	}
+
+	var changes []EnvChange
+
+	for _, key := range slices.Sorted(maps.Keys(composed)) {
+		if change := composed[key]; change.OldValue != change.NewValue {
+			changes = append(changes, change)
+		}
+	}
+
+	return changes
+}
+
+// FindLoadPaths returns the files named filename (along with their drop-ins, the file for profile and the
+// overlay for the git branch checked out, if any) in dir and its parents, from the highest directory down
+func FindLoadPaths(dir string, filename string, profile string) []string {
+	// paths are grouped per directory so the main file always comes before its drop-ins, its profile and its
+	// branch overlay
+	var groups [][]string
+
+	branch, repoDir := GitBranch(dir)
+
+	for _, currentDir := range walkDirs(dir, filename) {
+		var paths []string
 
-	for {
 		path := filepath.Join(currentDir, filename)
 		// check if the file exists ignoring errors for files not found
 		if _, err := os.Stat(path); err == nil {
 			paths = append(paths, path)
 		}
 
+		paths = append(paths, findDropInPaths(currentDir, filename)...)
+
+		if ValidProfile(profile) {
+			profilePath := filepath.Join(currentDir, ProfileFilename(filename, profile))
+			if _, err := os.Stat(profilePath); err == nil {
+				paths = append(paths, profilePath)
+			}
+		}
+
+		// overlays belong to the repository, so the directories above it don't get to define them
+		if len(branch) > 0 && isSubDir(currentDir, repoDir) {
+			branchPath := filepath.Join(currentDir, BranchFilename(filename, branch))
+			if _, err := os.Stat(branchPath); err == nil {
+				paths = append(paths, branchPath)
+			}
+		}
+
+		if len(paths) > 0 {
+			groups = append(groups, paths)
+		}
+	}
+
+	// reverse so that processing can happen naturally (highest directory working down)
+	slices.Reverse(groups)
+
+	return slices.Concat(groups...)
+}
+
+// FindProfiles returns the names of the profiles with a file (envy.sh -> envy.<profile>.sh) in dir or its
+// parents, sorted
+func FindProfiles(dir string, filename string) []string {
+	ext := filepath.Ext(filename)
+	prefix := strings.TrimSuffix(filename, ext) + "."
+
+	var profiles []string
+
+	for _, currentDir := range walkDirs(dir, filename) {
+		matches, _ := filepath.Glob(filepath.Join(currentDir, prefix+"*"+ext))
+
+		for _, match := range matches {
+			profile := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(match), prefix), ext)
+
+			if ValidProfile(profile) && !slices.Contains(profiles, profile) {
+				profiles = append(profiles, profile)
+			}
+		}
+	}
+
+	slices.Sort(profiles)
+
+	return profiles
+}
+
+// ValidProfile reports whether name can be used as a profile: letters, digits, - and _ only so it always
+// names a file next to the main one
+func ValidProfile(name string) bool {
+	return len(name) > 0 && strings.Trim(name, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_") == ""
+}
+
+// ProfileFilename returns the name of the file for profile next to filename (envy.sh -> envy.dev.sh)
+func ProfileFilename(filename string, profile string) string {
+	ext := filepath.Ext(filename)
+
+	return strings.TrimSuffix(filename, ext) + "." + profile + ext
+}
+
+// isSubDir reports whether dir is base or one of the directories below it
+func isSubDir(dir string, base string) bool {
+	rel, err := filepath.Rel(base, dir)
+
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// walkDirs returns dir and its parents up to the first one that ends the search for filename
+func walkDirs(dir string, filename string) []string {
+	var dirs []string
+
+	currentDir := dir
+	boundaries := WalkBoundaries()
+
+	for {
+		dirs = append(dirs, currentDir)
+
+		// stop walking at directories that declare themselves a root or sit on a configured boundary
+		if isRootDir(currentDir, filename, boundaries) {
+			break
+		}
+
 		// get the parent directory
 		parentDir := filepath.Dir(currentDir)
 
@@ -87,8 +242,25 @@ func FindLoadPaths(filename string) []string {
 		currentDir = parentDir
 	}
 
-	// reverse so that processing can happen naturally (highest directory working down)
-	slices.Reverse(paths)
+	return dirs
+}
+
+// findDropInPaths returns the files in the drop-in directory for filename (envy.sh -> envy.d/*.sh) in
+// lexical order
+func findDropInPaths(dir string, filename string) []string {
+	ext := filepath.Ext(filename)
+	dropInDir := filepath.Join(dir, strings.TrimSuffix(filename, ext)+".d")
+
+	matches, _ := filepath.Glob(filepath.Join(dropInDir, "*"+ext))
+
+	var paths []string
+
+	for _, match := range matches {
+		// skip anything that isn't a regular file (e.g. directories named like a script)
+		if info, err := os.Stat(match); err == nil && info.Mode().IsRegular() {
+			paths = append(paths, match)
+		}
+	}
 
 	return paths
 }
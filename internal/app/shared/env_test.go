@@ -62,6 +62,35 @@ func TestNewEnv(t *testing.T) {
 	}
 }
 
+func TestVars(t *testing.T) {
+	env := NewEnv([]string{"FOO=bar", "FIZZ=buzz"})
+
+	got := env.Vars()
+	want := map[string]string{"FOO": "bar", "FIZZ": "buzz"}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Vars() = %v, want %v", got, want)
+	}
+
+	// modifying the returned map must not modify the env
+	got["FOO"] = "changed"
+
+	if env.vars["FOO"] != "bar" {
+		t.Errorf("Vars() returned the underlying map instead of a copy")
+	}
+}
+
+func TestEnviron(t *testing.T) {
+	env := NewEnv([]string{"FOO=bar", "FIZZ=buzz=1"})
+
+	got := env.Environ()
+	want := []string{"FIZZ=buzz=1", "FOO=bar"}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Environ() = %v, want %v", got, want)
+	}
+}
+
 func TestDiff(t *testing.T) {
 	tests := []struct {
 		name string
@@ -135,6 +164,38 @@ func TestDiff(t *testing.T) {
 	}
 }
 
+func TestComposeChanges(t *testing.T) {
+	tests := []struct {
+		name       string
+		changeSets [][]EnvChange
+		want       []EnvChange
+	}{
+		{
+			name:       "separate keys",
+			changeSets: [][]EnvChange{{{Key: "FOO", NewValue: "bar"}}, {{Key: "BAR", OldValue: "baz"}}},
+			want:       []EnvChange{{Key: "BAR", OldValue: "baz"}, {Key: "FOO", NewValue: "bar"}},
+		},
+		{
+			name:       "changed twice",
+			changeSets: [][]EnvChange{{{Key: "PATH", OldValue: "/bin", NewValue: "/a:/bin"}}, {{Key: "PATH", OldValue: "/a:/bin", NewValue: "/b:/a:/bin"}}},
+			want:       []EnvChange{{Key: "PATH", OldValue: "/bin", NewValue: "/b:/a:/bin"}},
+		},
+		{
+			name:       "added then removed",
+			changeSets: [][]EnvChange{{{Key: "FOO", NewValue: "bar"}}, {{Key: "FOO", OldValue: "bar"}}},
+			want:       nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ComposeChanges(tt.changeSets...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ComposeChanges() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestFindLoadPaths(t *testing.T) {
 	tmp := t.TempDir()
 	tmpDir, err := filepath.EvalSymlinks(tmp)
@@ -172,9 +233,6 @@ func TestFindLoadPaths(t *testing.T) {
 		}
 	}
 
-	oldWd, _ := os.Getwd()
-	defer os.Chdir(oldWd)
-
 	tests := []struct {
 		name     string
 		workDir  string
@@ -218,11 +276,7 @@ func TestFindLoadPaths(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if err := os.Chdir(tt.workDir); err != nil {
-				t.Fatalf("failed to chdir to %s: %v", tt.workDir, err)
-			}
-
-			got := FindLoadPaths(tt.filename)
+			got := FindLoadPaths(tt.workDir, tt.filename, "")
 
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("findLoadPaths() got = %v, want %v", got, tt.want)
@@ -230,3 +284,141 @@ func TestFindLoadPaths(t *testing.T) {
 		})
 	}
 }
+
+func TestFindLoadPaths_DropIns(t *testing.T) {
+	tmp := t.TempDir()
+	tmpDir, err := filepath.EvalSymlinks(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create directory structure:
+	// tmpDir/envy.d/20-cloud.sh
+	// tmpDir/a/envy.sh
+	// tmpDir/a/envy.d/10-db.sh
+	// tmpDir/a/envy.d/20-tools.sh
+	// tmpDir/a/envy.d/notes.txt (ignored)
+	// tmpDir/a/envy.d/nested.sh/ (ignored)
+
+	dirs := []string{
+		filepath.Join(tmpDir, "envy.d"),
+		filepath.Join(tmpDir, "a", "envy.d", "nested.sh"),
+	}
+
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("failed to create dir %s: %v", dir, err)
+		}
+	}
+
+	files := []string{
+		filepath.Join(tmpDir, "envy.d", "20-cloud.sh"),
+		filepath.Join(tmpDir, "a", "envy.sh"),
+		filepath.Join(tmpDir, "a", "envy.d", "20-tools.sh"),
+		filepath.Join(tmpDir, "a", "envy.d", "10-db.sh"),
+		filepath.Join(tmpDir, "a", "envy.d", "notes.txt"),
+	}
+
+	for _, file := range files {
+		if err := os.WriteFile(file, []byte(""), 0644); err != nil {
+			t.Fatalf("failed to write file %s: %v", file, err)
+		}
+	}
+
+	got := FindLoadPaths(filepath.Join(tmpDir, "a"), "envy.sh", "")
+	want := []string{
+		filepath.Join(tmpDir, "envy.d", "20-cloud.sh"),
+		filepath.Join(tmpDir, "a", "envy.sh"),
+		filepath.Join(tmpDir, "a", "envy.d", "10-db.sh"),
+		filepath.Join(tmpDir, "a", "envy.d", "20-tools.sh"),
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FindLoadPaths() got = %v, want %v", got, want)
+	}
+}
+
+func TestFindLoadPaths_Profile(t *testing.T) {
+	tmp := t.TempDir()
+	tmpDir, err := filepath.EvalSymlinks(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// tmpDir/envy.staging.sh
+	// tmpDir/a/envy.sh
+	// tmpDir/a/envy.d/10-db.sh
+	// tmpDir/a/envy.dev.sh
+	// tmpDir/a/envy.branch.main.sh (not a profile)
+	os.MkdirAll(filepath.Join(tmpDir, "a", "envy.d"), 0755)
+
+	for _, file := range []string{"envy.staging.sh", "a/envy.sh", "a/envy.d/10-db.sh", "a/envy.dev.sh", "a/envy.branch.main.sh"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, file), []byte(""), 0644); err != nil {
+			t.Fatalf("failed to write file %s: %v", file, err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		profile string
+		want    []string
+	}{
+		{
+			name:    "no profile",
+			profile: "",
+			want:    []string{filepath.Join(tmpDir, "a", "envy.sh"), filepath.Join(tmpDir, "a", "envy.d", "10-db.sh")},
+		},
+		{
+			name:    "after the drop-ins",
+			profile: "dev",
+			want:    []string{filepath.Join(tmpDir, "a", "envy.sh"), filepath.Join(tmpDir, "a", "envy.d", "10-db.sh"), filepath.Join(tmpDir, "a", "envy.dev.sh")},
+		},
+		{
+			name:    "without a main file",
+			profile: "staging",
+			want:    []string{filepath.Join(tmpDir, "envy.staging.sh"), filepath.Join(tmpDir, "a", "envy.sh"), filepath.Join(tmpDir, "a", "envy.d", "10-db.sh")},
+		},
+		{
+			name:    "invalid",
+			profile: "branch.main",
+			want:    []string{filepath.Join(tmpDir, "a", "envy.sh"), filepath.Join(tmpDir, "a", "envy.d", "10-db.sh")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FindLoadPaths(filepath.Join(tmpDir, "a"), "envy.sh", tt.profile); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindLoadPaths() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got := FindProfiles(filepath.Join(tmpDir, "a"), "envy.sh"); !reflect.DeepEqual(got, []string{"dev", "staging"}) {
+		t.Errorf("FindProfiles() got = %v, want [dev staging]", got)
+	}
+}
+
+func TestValidProfile(t *testing.T) {
+	for name, want := range map[string]bool{"dev": true, "eu-west_1": true, "": false, "a.b": false, "../dev": false} {
+		if got := ValidProfile(name); got != want {
+			t.Errorf("ValidProfile(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestIsSubDir(t *testing.T) {
+	for _, tt := range []struct {
+		dir  string
+		want bool
+	}{
+		{dir: "/repo", want: true},
+		{dir: "/repo/sub", want: true},
+		{dir: "/", want: false},
+		{dir: "/repository", want: false},
+		{dir: "/..repo", want: false},
+	} {
+		if got := isSubDir(tt.dir, "/repo"); got != tt.want {
+			t.Errorf("isSubDir(%q, /repo) = %v, want %v", tt.dir, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package shared
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/oklog/ulid/v2"
+)
+
+var SupportedFormats = []string{"shell", "dotenv", "json", "systemd", "docker", "github"}
+
+// FormatEnv renders vars (and the keys in unset) as lines in the given format. Formats that have no
+// way to express removing a variable silently skip the unset keys.
+func FormatEnv(format string, vars map[string]string, unset []string) ([]string, error) {
+	keys := slices.Sorted(maps.Keys(vars))
+
+	slices.Sort(unset)
+
+	switch format {
+	case "shell":
+		return formatShell(keys, vars, unset), nil
+	case "dotenv":
+		return formatQuoted(keys, vars), nil
+	case "json":
+		return formatJson(vars, unset)
+	case "systemd":
+		return formatQuoted(keys, vars), nil
+	case "docker":
+		return formatDocker(keys, vars)
+	case "github":
+		return formatGithub(keys, vars), nil
+	}
+
+	return nil, fmt.Errorf("%s is not a supported format; valid values are [%s]", format, strings.Join(SupportedFormats, ", "))
+}
+
+func formatShell(keys []string, vars map[string]string, unset []string) []string {
+	var lines []string
+
+	for _, key := range unset {
+		lines = append(lines, fmt.Sprintf("unset %s", key))
+	}
+
+	for _, key := range keys {
+		// export FOO='it'\''s'
+		lines = append(lines, fmt.Sprintf("export %s=%s", key, ShellQuote(vars[key])))
+	}
+
+	return lines
+}
+
+// ShellQuote quotes value in single quotes for sh, escaping the single quotes in it, so nothing in it is expanded
+// or run
+func ShellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// formatQuoted renders KEY="value" lines which both dotenv parsers and systemd's EnvironmentFile= understand
+func formatQuoted(keys []string, vars map[string]string) []string {
+	var lines []string
+
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\n`)
+
+	for _, key := range keys {
+		lines = append(lines, fmt.Sprintf("%s=\"%s\"", key, replacer.Replace(vars[key])))
+	}
+
+	return lines
+}
+
+func formatJson(vars map[string]string, unset []string) ([]string, error) {
+	// unset keys are rendered as null
+	values := make(map[string]*string)
+
+	for key, value := range vars {
+		values[key] = &value
+	}
+
+	for _, key := range unset {
+		values[key] = nil
+	}
+
+	content, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{string(content)}, nil
+}
+
+func formatDocker(keys []string, vars map[string]string) ([]string, error) {
+	var lines []string
+
+	for _, key := range keys {
+		// docker env-files take values literally and have no way to continue a value on the next line
+		if strings.Contains(vars[key], "\n") {
+			return nil, fmt.Errorf("%s contains a newline which the docker format does not support", key)
+		}
+
+		lines = append(lines, fmt.Sprintf("%s=%s", key, vars[key]))
+	}
+
+	return lines, nil
+}
+
+func formatGithub(keys []string, vars map[string]string) []string {
+	var lines []string
+
+	for _, key := range keys {
+		if !strings.Contains(vars[key], "\n") {
+			lines = append(lines, fmt.Sprintf("%s=%s", key, vars[key]))
+			continue
+		}
+
+		// multiline values use the heredoc syntax with a delimiter that can't appear in the value
+		delimiter := "ENVY_" + ulid.Make().String()
+		lines = append(lines, fmt.Sprintf("%s<<%s", key, delimiter), vars[key], delimiter)
+	}
+
+	return lines
+}
@@ -0,0 +1,121 @@
+package shared
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFormatEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		format    string
+		vars      map[string]string
+		unset     []string
+		wantLines []string
+		wantErr   bool
+	}{
+		{
+			name:   "shell",
+			format: "shell",
+			vars:   map[string]string{"FOO": "bar", "QUOTE": "it's"},
+			unset:  []string{"GONE"},
+			wantLines: []string{
+				"unset GONE",
+				"export FOO='bar'",
+				`export QUOTE='it'\''s'`,
+			},
+		},
+		{
+			name:   "dotenv",
+			format: "dotenv",
+			vars:   map[string]string{"FOO": "bar", "ESCAPED": "a \"b\" $c\nd"},
+			unset:  []string{"GONE"},
+			wantLines: []string{
+				`ESCAPED="a \"b\" \$c\nd"`,
+				`FOO="bar"`,
+			},
+		},
+		{
+			name:   "systemd",
+			format: "systemd",
+			vars:   map[string]string{"FOO": `C:\bar`},
+			wantLines: []string{
+				`FOO="C:\\bar"`,
+			},
+		},
+		{
+			name:   "json",
+			format: "json",
+			vars:   map[string]string{"FOO": "bar"},
+			unset:  []string{"GONE"},
+			wantLines: []string{
+				"{\n  \"FOO\": \"bar\",\n  \"GONE\": null\n}",
+			},
+		},
+		{
+			name:   "docker",
+			format: "docker",
+			vars:   map[string]string{"FOO": "bar baz", "QUOTED": `"as is"`},
+			unset:  []string{"GONE"},
+			wantLines: []string{
+				"FOO=bar baz",
+				`QUOTED="as is"`,
+			},
+		},
+		{
+			name:    "docker multiline",
+			format:  "docker",
+			vars:    map[string]string{"FOO": "bar\nbaz"},
+			wantErr: true,
+		},
+		{
+			name:   "github",
+			format: "github",
+			vars:   map[string]string{"FOO": "bar"},
+			wantLines: []string{
+				"FOO=bar",
+			},
+		},
+		{
+			name:    "unsupported",
+			format:  "xml",
+			vars:    map[string]string{"FOO": "bar"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FormatEnv(tt.format, tt.vars, tt.unset)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FormatEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.wantLines) {
+				t.Errorf("FormatEnv() = %q, want %q", got, tt.wantLines)
+			}
+		})
+	}
+}
+
+func TestFormatEnv_GithubMultiline(t *testing.T) {
+	got, err := FormatEnv("github", map[string]string{"FOO": "bar\nbaz"}, nil)
+	if err != nil {
+		t.Fatalf("FormatEnv() unexpected error: %v", err)
+	}
+
+	if len(got) != 3 {
+		t.Fatalf("expected 3 lines, got %d", len(got))
+	}
+
+	delimiter, found := strings.CutPrefix(got[0], "FOO<<")
+	if !found {
+		t.Fatalf("expected heredoc start, got %q", got[0])
+	}
+
+	if got[1] != "bar\nbaz" || got[2] != delimiter {
+		t.Errorf("unexpected heredoc body %q", got)
+	}
+}
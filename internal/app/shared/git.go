@@ -0,0 +1,75 @@
+package shared
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GitBranch returns the branch checked out in the git repository enclosing dir by reading its HEAD along with
+// the root of the repository, or nothing outside a repository and when HEAD is detached
+func GitBranch(dir string) (string, string) {
+	root, gitDir := findGitDir(dir)
+	if len(gitDir) == 0 {
+		return "", ""
+	}
+
+	content, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return "", ""
+	}
+
+	// a detached HEAD holds a commit id instead of a ref
+	branch, ok := strings.CutPrefix(strings.TrimSpace(string(content)), "ref: refs/heads/")
+	if !ok {
+		return "", ""
+	}
+
+	return branch, root
+}
+
+// BranchFilename returns the name of the overlay file for branch next to filename (envy.sh ->
+// envy.branch.<branch>.sh), with the slashes in the branch name (feature/x) turned into dashes (feature-x)
+func BranchFilename(filename string, branch string) string {
+	return ProfileFilename(filename, "branch."+strings.ReplaceAll(branch, "/", "-"))
+}
+
+// findGitDir returns the root of the repository enclosing dir and its git dir: .git is a directory in a regular
+// checkout and a file pointing to it (gitdir: PATH) in worktrees and submodules
+func findGitDir(dir string) (string, string) {
+	currentDir := dir
+
+	for {
+		path := filepath.Join(currentDir, ".git")
+
+		if info, err := os.Stat(path); err == nil {
+			if info.IsDir() {
+				return currentDir, path
+			}
+
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return "", ""
+			}
+
+			gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(content)), "gitdir:")
+			if !ok {
+				return "", ""
+			}
+
+			gitDir = strings.TrimSpace(gitDir)
+			if !filepath.IsAbs(gitDir) {
+				gitDir = filepath.Join(currentDir, gitDir)
+			}
+
+			return currentDir, gitDir
+		}
+
+		parentDir := filepath.Dir(currentDir)
+		if parentDir == currentDir {
+			return "", ""
+		}
+
+		currentDir = parentDir
+	}
+}
@@ -0,0 +1,117 @@
+package shared
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestGitBranch(t *testing.T) {
+	tmp := t.TempDir()
+
+	// tmp/repo/.git/HEAD (a regular checkout)
+	// tmp/worktree/.git -> tmp/repo/.git/worktrees/wt (a linked worktree)
+	// tmp/detached/.git/HEAD
+	// tmp/plain
+	dirs := []string{
+		filepath.Join(tmp, "repo", ".git", "worktrees", "wt"),
+		filepath.Join(tmp, "repo", "sub", "dir"),
+		filepath.Join(tmp, "worktree"),
+		filepath.Join(tmp, "detached", ".git"),
+		filepath.Join(tmp, "plain"),
+	}
+
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("failed to create dir %s: %v", dir, err)
+		}
+	}
+
+	files := map[string]string{
+		filepath.Join(tmp, "repo", ".git", "HEAD"):                    "ref: refs/heads/main\n",
+		filepath.Join(tmp, "repo", ".git", "worktrees", "wt", "HEAD"): "ref: refs/heads/feature/x\n",
+		filepath.Join(tmp, "worktree", ".git"):                        "gitdir: ../repo/.git/worktrees/wt\n",
+		filepath.Join(tmp, "detached", ".git", "HEAD"):                "0123456789abcdef0123456789abcdef01234567\n",
+	}
+
+	for file, content := range files {
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write file %s: %v", file, err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		dir  string
+		want string
+	}{
+		{name: "checkout", dir: filepath.Join(tmp, "repo"), want: "main"},
+		{name: "subdirectory", dir: filepath.Join(tmp, "repo", "sub", "dir"), want: "main"},
+		{name: "worktree", dir: filepath.Join(tmp, "worktree"), want: "feature/x"},
+		{name: "detached", dir: filepath.Join(tmp, "detached"), want: ""},
+		{name: "not a repository", dir: filepath.Join(tmp, "plain"), want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := GitBranch(tt.dir); got != tt.want {
+				t.Errorf("GitBranch() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBranchFilename(t *testing.T) {
+	if got := BranchFilename("envy.sh", "feature/x"); got != "envy.branch.feature-x.sh" {
+		t.Errorf("BranchFilename() = %q, want envy.branch.feature-x.sh", got)
+	}
+}
+
+func TestFindLoadPaths_Branch(t *testing.T) {
+	tmp := t.TempDir()
+	tmpDir, err := filepath.EvalSymlinks(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// tmpDir/envy.branch.feature-x.sh (above the repository, ignored)
+	// tmpDir/repo/.git/HEAD
+	// tmpDir/repo/envy.sh
+	// tmpDir/repo/envy.dev.sh
+	// tmpDir/repo/envy.branch.feature-x.sh
+	repoDir := filepath.Join(tmpDir, "repo")
+	os.MkdirAll(filepath.Join(repoDir, ".git"), 0755)
+
+	for _, file := range []string{"envy.branch.feature-x.sh", "repo/envy.sh", "repo/envy.dev.sh", "repo/envy.branch.feature-x.sh"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, file), []byte(""), 0644); err != nil {
+			t.Fatalf("failed to write file %s: %v", file, err)
+		}
+	}
+
+	head := filepath.Join(repoDir, ".git", "HEAD")
+
+	os.WriteFile(head, []byte("ref: refs/heads/main\n"), 0644)
+
+	if got := FindLoadPaths(repoDir, "envy.sh", "dev"); len(got) != 2 {
+		t.Errorf("FindLoadPaths() got = %v, want no overlay on main", got)
+	}
+
+	// checking out the branch adds its overlay after the profile, only within the repository
+	os.WriteFile(head, []byte("ref: refs/heads/feature/x\n"), 0644)
+
+	got := FindLoadPaths(repoDir, "envy.sh", "dev")
+	want := []string{
+		filepath.Join(repoDir, "envy.sh"),
+		filepath.Join(repoDir, "envy.dev.sh"),
+		filepath.Join(repoDir, "envy.branch.feature-x.sh"),
+	}
+
+	if !slices.Equal(got, want) {
+		t.Errorf("FindLoadPaths() got = %v, want %v", got, want)
+	}
+
+	if profiles := FindProfiles(repoDir, "envy.sh"); !slices.Equal(profiles, []string{"dev"}) {
+		t.Errorf("FindProfiles() got = %v, want the overlay not to be listed as a profile", profiles)
+	}
+}
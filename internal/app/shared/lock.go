@@ -0,0 +1,59 @@
+package shared
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var ErrSessionLocked = errors.New("the session is locked by another envy process")
+
+// how often a contended lock is retried
+var lockPollInterval = 20 * time.Millisecond
+
+// SessionLock serializes the processes writing the files of a session (<session>.lock)
+type SessionLock struct {
+	file *os.File
+}
+
+// LockSession takes the lock of a session, waiting up to timeout for the process holding it to release it
+func LockSession(sessionKey string, timeout time.Duration) (*SessionLock, error) {
+	name := SessionFilepath(sessionKey, "lock")
+
+	err := os.MkdirAll(filepath.Dir(name), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+
+	for {
+		locked, err := tryLock(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		if locked {
+			return &SessionLock{file: file}, nil
+		}
+
+		if time.Now().After(deadline) {
+			file.Close()
+			return nil, ErrSessionLocked
+		}
+
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// Unlock releases the lock (closing the file is enough, which also happens when the process exits)
+func (l *SessionLock) Unlock() error {
+	return l.file.Close()
+}
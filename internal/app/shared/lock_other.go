@@ -0,0 +1,11 @@
+//go:build !unix
+
+package shared
+
+import (
+	"os"
+)
+
+func tryLock(_ *os.File) (bool, error) {
+	return true, nil
+}
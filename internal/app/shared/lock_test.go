@@ -0,0 +1,43 @@
+//go:build unix
+
+package shared
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLockSession(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	lock, err := LockSession("12345678", 0)
+	if err != nil {
+		t.Fatalf("LockSession() unexpected error: %v", err)
+	}
+
+	// a contended lock gives up after the timeout
+	if _, err := LockSession("12345678", 50*time.Millisecond); !errors.Is(err, ErrSessionLocked) {
+		t.Fatalf("LockSession() error = %v, want ErrSessionLocked", err)
+	}
+
+	// other sessions aren't affected
+	other, err := LockSession("87654321", 0)
+	if err != nil {
+		t.Fatalf("LockSession() unexpected error for another session: %v", err)
+	}
+	other.Unlock()
+
+	// a waiting caller gets the lock once it is released
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		lock.Unlock()
+	}()
+
+	waited, err := LockSession("12345678", 5*time.Second)
+	if err != nil {
+		t.Fatalf("LockSession() unexpected error after the lock was released: %v", err)
+	}
+
+	waited.Unlock()
+}
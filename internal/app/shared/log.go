@@ -0,0 +1,148 @@
+package shared
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+var SupportedLogLevels = []string{"quiet", "info", "debug"}
+
+const DefaultLogFormat = "envy: %s"
+
+const (
+	colorReset  = "\033[0m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorRed    = "\033[31m"
+)
+
+// Logger writes the summaries shown in the terminal when envy loads or unloads files, controlled by
+// ENVY_LOG (quiet, info or debug) and ENVY_LOG_FORMAT (a printf format for each line, e.g. "envy: %s")
+type Logger struct {
+	writer io.Writer
+	level  int
+	format string
+	color  bool
+}
+
+// NewLogger returns a logger writing to w, which is colored when w is a terminal and NO_COLOR isn't set
+func NewLogger(w io.Writer) *Logger {
+	level := slices.Index(SupportedLogLevels, os.Getenv("ENVY_LOG"))
+	if level < 0 {
+		level = slices.Index(SupportedLogLevels, "info")
+	}
+
+	format := os.Getenv("ENVY_LOG_FORMAT")
+	if !validLogFormat(format) {
+		format = DefaultLogFormat
+	}
+
+	return &Logger{
+		writer: w,
+		level:  level,
+		format: format,
+		color:  isTerminal(w) && len(os.Getenv("NO_COLOR")) == 0,
+	}
+}
+
+func (l *Logger) Info(format string, args ...any) {
+	l.log("info", format, args...)
+}
+
+func (l *Logger) Debug(format string, args ...any) {
+	l.log("debug", format, args...)
+}
+
+// Loading reports the files being loaded with the home dir shortened to ~
+func (l *Logger) Loading(paths []string) {
+	if len(paths) == 0 {
+		return
+	}
+
+	var shortPaths []string
+	for _, path := range paths {
+		shortPaths = append(shortPaths, shortenHome(path))
+	}
+
+	l.Info("loading %s", strings.Join(shortPaths, " "))
+}
+
+// Changes reports the keys added (+), changed (~) and removed (-) in the style of direnv, including the new
+// values at the debug level
+func (l *Logger) Changes(changes []EnvChange) {
+	if len(changes) == 0 {
+		return
+	}
+
+	changes = slices.Clone(changes)
+	slices.SortFunc(changes, func(a, b EnvChange) int { return strings.Compare(a.Key, b.Key) })
+
+	var tokens []string
+	for _, change := range changes {
+		tokens = append(tokens, l.changeToken(change))
+	}
+
+	l.Info("export %s", strings.Join(tokens, " "))
+
+	for _, change := range changes {
+		if len(change.NewValue) > 0 {
+			l.Debug("%s=%s", change.Key, change.NewValue)
+		}
+	}
+}
+
+func (l *Logger) changeToken(change EnvChange) string {
+	sign := change.Sign()
+
+	if !l.color {
+		return sign + change.Key
+	}
+
+	color := map[string]string{"+": colorGreen, "~": colorYellow, "-": colorRed}[sign]
+
+	return color + sign + change.Key + colorReset
+}
+
+func (l *Logger) log(level string, format string, args ...any) {
+	if l.level < slices.Index(SupportedLogLevels, level) {
+		return
+	}
+
+	fmt.Fprintf(l.writer, l.format+"\n", fmt.Sprintf(format, args...))
+}
+
+// validLogFormat reports whether format has exactly one %s and no other verbs (%% is a literal %), since
+// anything else would print %!(EXTRA ...) or %!d(MISSING) on every line
+func validLogFormat(format string) bool {
+	verbs := strings.ReplaceAll(format, "%%", "")
+
+	return strings.Count(verbs, "%") == 1 && strings.Count(verbs, "%s") == 1
+}
+
+func shortenHome(path string) string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil || len(homeDir) == 0 {
+		return path
+	}
+
+	if rel, err := filepath.Rel(homeDir, path); err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+		return filepath.Join("~", rel)
+	}
+
+	return path
+}
+
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+
+	info, err := file.Stat()
+
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,129 @@
+package shared
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	changes := []EnvChange{
+		{Key: "PATH", OldValue: "/bin", NewValue: "/a/bin:/bin"},
+		{Key: "FOO", NewValue: "bar"},
+		{Key: "BAR", OldValue: "baz"},
+	}
+
+	tests := []struct {
+		name       string
+		level      string
+		format     string
+		wantOutput string
+	}{
+		{
+			name:       "info",
+			level:      "info",
+			wantOutput: "envy: loading ~/a/envy.sh /etc/envy.sh\nenvy: export -BAR +FOO ~PATH\n",
+		},
+		{
+			name:       "default level",
+			level:      "",
+			wantOutput: "envy: loading ~/a/envy.sh /etc/envy.sh\nenvy: export -BAR +FOO ~PATH\n",
+		},
+		{
+			name:       "debug",
+			level:      "debug",
+			wantOutput: "envy: loading ~/a/envy.sh /etc/envy.sh\nenvy: export -BAR +FOO ~PATH\nenvy: FOO=bar\nenvy: PATH=/a/bin:/bin\n",
+		},
+		{
+			name:       "quiet",
+			level:      "quiet",
+			wantOutput: "",
+		},
+		{
+			name:       "format",
+			level:      "info",
+			format:     "[envy] %s",
+			wantOutput: "[envy] loading ~/a/envy.sh /etc/envy.sh\n[envy] export -BAR +FOO ~PATH\n",
+		},
+		{
+			name:       "format with a literal percent",
+			level:      "info",
+			format:     "100%% envy: %s",
+			wantOutput: "100% envy: loading ~/a/envy.sh /etc/envy.sh\n100% envy: export -BAR +FOO ~PATH\n",
+		},
+		{
+			name:       "format without a verb",
+			level:      "info",
+			format:     "envy",
+			wantOutput: "envy: loading ~/a/envy.sh /etc/envy.sh\nenvy: export -BAR +FOO ~PATH\n",
+		},
+		{
+			name:       "format with other verbs",
+			level:      "info",
+			format:     "%d envy: %s",
+			wantOutput: "envy: loading ~/a/envy.sh /etc/envy.sh\nenvy: export -BAR +FOO ~PATH\n",
+		},
+		{
+			name:       "format with two verbs",
+			level:      "info",
+			format:     "%s: %s",
+			wantOutput: "envy: loading ~/a/envy.sh /etc/envy.sh\nenvy: export -BAR +FOO ~PATH\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", "/home/test")
+			t.Setenv("ENVY_LOG", tt.level)
+			t.Setenv("ENVY_LOG_FORMAT", tt.format)
+
+			var buf bytes.Buffer
+
+			logger := NewLogger(&buf)
+			logger.Loading([]string{"/home/test/a/envy.sh", "/etc/envy.sh"})
+			logger.Changes(changes)
+
+			if buf.String() != tt.wantOutput {
+				t.Errorf("output = %q, want %q", buf.String(), tt.wantOutput)
+			}
+		})
+	}
+}
+
+func TestLogger_Color(t *testing.T) {
+	logger := &Logger{color: true}
+
+	tests := []struct {
+		change EnvChange
+		want   string
+	}{
+		{change: EnvChange{Key: "FOO", NewValue: "bar"}, want: colorGreen + "+FOO" + colorReset},
+		{change: EnvChange{Key: "FOO", OldValue: "bar", NewValue: "baz"}, want: colorYellow + "~FOO" + colorReset},
+		{change: EnvChange{Key: "FOO", OldValue: "bar"}, want: colorRed + "-FOO" + colorReset},
+	}
+
+	for _, tt := range tests {
+		if got := logger.changeToken(tt.change); got != tt.want {
+			t.Errorf("changeToken(%v) = %q, want %q", tt.change, got, tt.want)
+		}
+	}
+}
+
+func TestShortenHome(t *testing.T) {
+	t.Setenv("HOME", "/home/test")
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/home/test", want: "~"},
+		{path: "/home/test/a/envy.sh", want: "~/a/envy.sh"},
+		{path: "/home/tester/envy.sh", want: "/home/tester/envy.sh"},
+		{path: "/etc/envy.sh", want: "/etc/envy.sh"},
+	}
+
+	for _, tt := range tests {
+		if got := shortenHome(tt.path); got != tt.want {
+			t.Errorf("shortenHome(%s) = %s, want %s", tt.path, got, tt.want)
+		}
+	}
+}
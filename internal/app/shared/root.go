@@ -0,0 +1,83 @@
+package shared
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// a directory containing this file is treated as the root of the walk
+var RootMarkerFilename = ".envy-root"
+
+// a line in an envy file matching this directive is treated the same as a root marker file
+var RootDirective = "# envy:root"
+
+// boundaries that can be set (comma separated) in ENVY_BOUNDARY to stop the walk early
+var SupportedBoundaries = []string{"home", "mount", "git"}
+
+func WalkBoundaries() []string {
+	var boundaries []string
+
+	for _, boundary := range strings.Split(os.Getenv("ENVY_BOUNDARY"), ",") {
+		boundary = strings.ToLower(strings.TrimSpace(boundary))
+
+		if slices.Contains(SupportedBoundaries, boundary) {
+			boundaries = append(boundaries, boundary)
+		}
+	}
+
+	return boundaries
+}
+
+func isRootDir(dir string, filename string, boundaries []string) bool {
+	if Exists(filepath.Join(dir, RootMarkerFilename)) || hasRootDirective(filepath.Join(dir, filename)) {
+		return true
+	}
+
+	for _, boundary := range boundaries {
+		switch boundary {
+		case "home":
+			homeDir, err := os.UserHomeDir()
+			if err == nil && filepath.Clean(homeDir) == dir {
+				return true
+			}
+		case "mount":
+			if isMountPoint(dir) {
+				return true
+			}
+		case "git":
+			// .git is a directory in a regular checkout and a file in worktrees and submodules
+			if Exists(filepath.Join(dir, ".git")) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func hasRootDirective(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == RootDirective {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Exists reports whether path exists
+func Exists(path string) bool {
+	_, err := os.Stat(path)
+
+	return err == nil
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package shared
+
+// isMountPoint is not supported on this platform so the mount boundary never stops the walk
+func isMountPoint(_ string) bool {
+	return false
+}
@@ -0,0 +1,182 @@
+package shared
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWalkBoundaries(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected []string
+	}{
+		{
+			name:     "unset",
+			value:    "",
+			expected: nil,
+		},
+		{
+			name:     "single",
+			value:    "git",
+			expected: []string{"git"},
+		},
+		{
+			name:     "multiple with spaces and case",
+			value:    "home, MOUNT ,git",
+			expected: []string{"home", "mount", "git"},
+		},
+		{
+			name:     "unsupported values are ignored",
+			value:    "home,nope",
+			expected: []string{"home"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ENVY_BOUNDARY", tt.value)
+
+			got := WalkBoundaries()
+
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("WalkBoundaries() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestIsRootDir(t *testing.T) {
+	tmp := t.TempDir()
+	tmpDir, err := filepath.EvalSymlinks(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create directory structure:
+	// tmpDir/marker/.envy-root
+	// tmpDir/directive/envy.sh (containing the root directive)
+	// tmpDir/repo/.git/
+	// tmpDir/home/
+	// tmpDir/plain/envy.sh
+
+	for _, dir := range []string{"marker", "directive", "repo/.git", "home", "plain"} {
+		if err := os.MkdirAll(filepath.Join(tmpDir, dir), 0755); err != nil {
+			t.Fatalf("failed to create dir %s: %v", dir, err)
+		}
+	}
+
+	files := map[string]string{
+		filepath.Join(tmpDir, "marker", RootMarkerFilename): "",
+		filepath.Join(tmpDir, "directive", "envy.sh"):       "export FOO=bar\n  " + RootDirective + "\n",
+		filepath.Join(tmpDir, "plain", "envy.sh"):           "export FOO=bar\n# envy:rooted\n",
+	}
+
+	for file, content := range files {
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write file %s: %v", file, err)
+		}
+	}
+
+	t.Setenv("HOME", filepath.Join(tmpDir, "home"))
+
+	tests := []struct {
+		name       string
+		dir        string
+		boundaries []string
+		expected   bool
+	}{
+		{
+			name:     "marker file",
+			dir:      filepath.Join(tmpDir, "marker"),
+			expected: true,
+		},
+		{
+			name:     "directive",
+			dir:      filepath.Join(tmpDir, "directive"),
+			expected: true,
+		},
+		{
+			name:     "plain",
+			dir:      filepath.Join(tmpDir, "plain"),
+			expected: false,
+		},
+		{
+			name:       "git without boundary",
+			dir:        filepath.Join(tmpDir, "repo"),
+			boundaries: nil,
+			expected:   false,
+		},
+		{
+			name:       "git with boundary",
+			dir:        filepath.Join(tmpDir, "repo"),
+			boundaries: []string{"git"},
+			expected:   true,
+		},
+		{
+			name:       "home with boundary",
+			dir:        filepath.Join(tmpDir, "home"),
+			boundaries: []string{"home"},
+			expected:   true,
+		},
+		{
+			name:       "mount with boundary",
+			dir:        filepath.Join(tmpDir, "plain"),
+			boundaries: []string{"mount"},
+			expected:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := isRootDir(tt.dir, "envy.sh", tt.boundaries)
+
+			if got != tt.expected {
+				t.Errorf("isRootDir() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFindLoadPaths_Root(t *testing.T) {
+	tmp := t.TempDir()
+	tmpDir, err := filepath.EvalSymlinks(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create directory structure:
+	// tmpDir/envy.sh
+	// tmpDir/a/envy.sh
+	// tmpDir/a/.envy-root
+	// tmpDir/a/b/envy.sh
+
+	if err := os.MkdirAll(filepath.Join(tmpDir, "a", "b"), 0755); err != nil {
+		t.Fatalf("failed to create dirs: %v", err)
+	}
+
+	files := []string{
+		filepath.Join(tmpDir, "envy.sh"),
+		filepath.Join(tmpDir, "a", "envy.sh"),
+		filepath.Join(tmpDir, "a", RootMarkerFilename),
+		filepath.Join(tmpDir, "a", "b", "envy.sh"),
+	}
+
+	for _, file := range files {
+		if err := os.WriteFile(file, []byte(""), 0644); err != nil {
+			t.Fatalf("failed to write file %s: %v", file, err)
+		}
+	}
+
+	got := FindLoadPaths(filepath.Join(tmpDir, "a", "b"), "envy.sh", "")
+	want := []string{
+		filepath.Join(tmpDir, "a", "envy.sh"),
+		filepath.Join(tmpDir, "a", "b", "envy.sh"),
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FindLoadPaths() got = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,28 @@
+//go:build unix
+
+package shared
+
+import (
+	"path/filepath"
+	"syscall"
+)
+
+// isMountPoint reports whether dir lives on a different device than its parent
+func isMountPoint(dir string) bool {
+	var dirStat, parentStat syscall.Stat_t
+
+	if err := syscall.Stat(dir, &dirStat); err != nil {
+		return false
+	}
+
+	parentDir := filepath.Dir(dir)
+	if parentDir == dir {
+		return false
+	}
+
+	if err := syscall.Stat(parentDir, &parentStat); err != nil {
+		return false
+	}
+
+	return dirStat.Dev != parentStat.Dev
+}
@@ -0,0 +1,220 @@
+package shared
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// SessionStateVersion is bumped whenever the layout of SessionState changes incompatibly
+const SessionStateVersion = 1
+
+// ErrNoSessionState is returned by LoadSessionState when nothing has been loaded in the session yet
+var ErrNoSessionState = errors.New("no session state")
+
+// SessionState is what envy loaded for a session (<session>.state.json): the single source of truth the
+// undo script is rendered from and commands such as status read. Baseline is the environment the session
+// started with (captured by init, or by the first gen otherwise)
+type SessionState struct {
+	Version   int               `json:"version"`
+	Parent    string            `json:"parent,omitempty"`
+	Dir       string            `json:"dir"`
+	LoadPaths []LoadPath        `json:"loadPaths"`
+	Changes   []EnvChange       `json:"changes"`
+	Baseline  map[string]string `json:"baseline"`
+	CreatedAt time.Time         `json:"createdAt"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+	History   []Transition      `json:"history,omitempty"`
+	Layers    []Layer           `json:"layers,omitempty"`
+}
+
+// Layer is what the envy files of a single directory loaded on top of the layers of its parents, so moving
+// between nested directories only evaluates (and undoes) the directories entered (and left)
+type Layer struct {
+	Dir       string      `json:"dir"`
+	LoadPaths []LoadPath  `json:"loadPaths"`
+	Changes   []EnvChange `json:"changes"`
+}
+
+// SessionHistoryLimit is how many transitions a session state keeps
+const SessionHistoryLimit = 20
+
+// Transition is an environment the session switched to: where it was loaded from and how much it changed
+type Transition struct {
+	At      time.Time `json:"at"`
+	Dir     string    `json:"dir"`
+	Paths   []string  `json:"paths"`
+	Changes int       `json:"changes"`
+}
+
+type LoadPath struct {
+	Path string `json:"path"`
+	Hash string `json:"hash"`
+}
+
+// NewLoadPaths hashes the content of each path (an empty hash means the file couldn't be read)
+func NewLoadPaths(paths []string) []LoadPath {
+	var loadPaths []LoadPath
+
+	for _, path := range paths {
+		loadPaths = append(loadPaths, LoadPath{Path: path, Hash: HashFile(path)})
+	}
+
+	return loadPaths
+}
+
+func HashFile(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func (s *SessionState) Paths() []string {
+	var paths []string
+
+	for _, loadPath := range s.LoadPaths {
+		paths = append(paths, loadPath.Path)
+	}
+
+	return paths
+}
+
+// the directory drop-ins of envy files live in (envy.sh -> envy.d, see findDropInPaths)
+var DropInDirname = "envy.d"
+
+// NewLayers groups load paths by the directory they belong to (drop-ins belong to the directory containing
+// the drop-in directory) in the order they are loaded, hashing the content of each path
+func NewLayers(paths []string) []Layer {
+	var layers []Layer
+
+	for _, path := range paths {
+		dir := filepath.Dir(path)
+		if filepath.Base(dir) == DropInDirname {
+			dir = filepath.Dir(dir)
+		}
+
+		if len(layers) == 0 || layers[len(layers)-1].Dir != dir {
+			layers = append(layers, Layer{Dir: dir})
+		}
+
+		last := &layers[len(layers)-1]
+		last.LoadPaths = append(last.LoadPaths, LoadPath{Path: path, Hash: HashFile(path)})
+	}
+
+	return layers
+}
+
+// CommonLayers returns how many layers at the bottom of both stacks load the same files with the same content
+func CommonLayers(a []Layer, b []Layer) int {
+	var count int
+
+	for count < len(a) && count < len(b) && a[count].Dir == b[count].Dir && slices.Equal(a[count].LoadPaths, b[count].LoadPaths) {
+		count++
+	}
+
+	return count
+}
+
+func (l Layer) Paths() []string {
+	var paths []string
+
+	for _, loadPath := range l.LoadPaths {
+		paths = append(paths, loadPath.Path)
+	}
+
+	return paths
+}
+
+// LoadedLayers returns the layers the state loads; states written before layers were tracked load a single one
+func (s *SessionState) LoadedLayers() []Layer {
+	if len(s.Layers) == 0 && len(s.Changes) > 0 {
+		return []Layer{{Dir: s.Dir, LoadPaths: s.LoadPaths, Changes: s.Changes}}
+	}
+
+	return s.Layers
+}
+
+// AddTransition records what the state loads in its history, dropping the oldest transitions past the limit
+func (s *SessionState) AddTransition() {
+	s.History = append(s.History, Transition{At: s.UpdatedAt, Dir: s.Dir, Paths: s.Paths(), Changes: len(s.Changes)})
+
+	if len(s.History) > SessionHistoryLimit {
+		s.History = s.History[len(s.History)-SessionHistoryLimit:]
+	}
+}
+
+func SessionStateFilepath(sessionKey string) string {
+	return SessionFilepath(sessionKey, "state.json")
+}
+
+func LoadSessionState(sessionKey string) (*SessionState, error) {
+	content, err := os.ReadFile(SessionStateFilepath(sessionKey))
+	if os.IsNotExist(err) {
+		return nil, ErrNoSessionState
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state SessionState
+
+	err = json.Unmarshal(content, &state)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the session state: %w", err)
+	}
+
+	if state.Version < 1 || state.Version > SessionStateVersion {
+		return nil, fmt.Errorf("unsupported session state version %d (this envy supports up to %d)", state.Version, SessionStateVersion)
+	}
+
+	return &state, nil
+}
+
+// Save writes the state atomically so readers never see a partial file
+func (s *SessionState) Save(sessionKey string) error {
+	name := SessionStateFilepath(sessionKey)
+
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(name), 0755)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), name)
+}
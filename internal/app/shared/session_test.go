@@ -0,0 +1,158 @@
+package shared
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSessionState(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+
+	if _, err := LoadSessionState("12345678"); !errors.Is(err, ErrNoSessionState) {
+		t.Fatalf("LoadSessionState() error = %v, want ErrNoSessionState", err)
+	}
+
+	envyFilepath := filepath.Join(tmp, "envy.sh")
+	os.WriteFile(envyFilepath, []byte("export FOO=bar"), 0644)
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	state := &SessionState{
+		Version:   SessionStateVersion,
+		Dir:       tmp,
+		LoadPaths: NewLoadPaths([]string{envyFilepath, filepath.Join(tmp, "missing.sh")}),
+		Changes:   []EnvChange{{Key: "FOO", NewValue: "bar"}},
+		Baseline:  map[string]string{"PATH": "/bin"},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := state.Save("12345678"); err != nil {
+		t.Fatalf("Save() unexpected error: %v", err)
+	}
+
+	loaded, err := LoadSessionState("12345678")
+	if err != nil {
+		t.Fatalf("LoadSessionState() unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(loaded, state) {
+		t.Errorf("LoadSessionState() = %+v, want %+v", loaded, state)
+	}
+
+	if len(loaded.LoadPaths[0].Hash) == 0 || len(loaded.LoadPaths[1].Hash) != 0 {
+		t.Errorf("expected a hash for the existing file only, got %+v", loaded.LoadPaths)
+	}
+
+	if paths := loaded.Paths(); !reflect.DeepEqual(paths, []string{envyFilepath, filepath.Join(tmp, "missing.sh")}) {
+		t.Errorf("Paths() = %v", paths)
+	}
+
+	// no temp files are left behind
+	entries, _ := os.ReadDir(CacheDir())
+	if len(entries) != 1 {
+		t.Errorf("expected only the state file in the cache dir, got %d entries", len(entries))
+	}
+}
+
+func TestLoadSessionState_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "not json", content: "{"},
+		{name: "no version", content: `{"dir": "/"}`},
+		{name: "newer version", content: `{"version": 999}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+
+			os.MkdirAll(CacheDir(), 0755)
+			os.WriteFile(SessionStateFilepath("12345678"), []byte(tt.content), 0644)
+
+			if _, err := LoadSessionState("12345678"); err == nil || errors.Is(err, ErrNoSessionState) {
+				t.Errorf("LoadSessionState() error = %v, want an invalid state error", err)
+			}
+		})
+	}
+}
+
+func TestSessionState_AddTransition(t *testing.T) {
+	state := &SessionState{}
+
+	for i := range SessionHistoryLimit + 5 {
+		state.Dir = strconv.Itoa(i)
+		state.LoadPaths = []LoadPath{{Path: "envy.sh"}}
+		state.AddTransition()
+	}
+
+	if len(state.History) != SessionHistoryLimit {
+		t.Fatalf("expected the history to be bounded to %d transitions, got %d", SessionHistoryLimit, len(state.History))
+	}
+
+	if first, last := state.History[0].Dir, state.History[len(state.History)-1].Dir; first != "5" || last != strconv.Itoa(SessionHistoryLimit+4) {
+		t.Errorf("expected the oldest transitions to be dropped, got %s to %s", first, last)
+	}
+}
+
+func TestNewLayers(t *testing.T) {
+	tmp := t.TempDir()
+
+	paths := []string{
+		filepath.Join(tmp, "envy.sh"),
+		filepath.Join(tmp, "envy.d", "a.sh"),
+		filepath.Join(tmp, "project", "envy.sh"),
+		filepath.Join(tmp, "project", "conf.d", "envy.sh"),
+	}
+
+	layers := NewLayers(paths)
+
+	if len(layers) != 3 {
+		t.Fatalf("NewLayers() returned %d layers, want 3", len(layers))
+	}
+
+	if layers[0].Dir != tmp || !reflect.DeepEqual(layers[0].Paths(), paths[:2]) {
+		t.Errorf("expected the drop-ins in the same layer as their directory, got %+v", layers[0])
+	}
+
+	if layers[1].Dir != filepath.Join(tmp, "project") || !reflect.DeepEqual(layers[1].Paths(), paths[2:3]) {
+		t.Errorf("unexpected layer %+v", layers[1])
+	}
+
+	// only the drop-in directory belongs to its parent, not any directory named *.d
+	if layers[2].Dir != filepath.Join(tmp, "project", "conf.d") {
+		t.Errorf("expected conf.d to be a layer of its own, got %+v", layers[2])
+	}
+}
+
+func TestCommonLayers(t *testing.T) {
+	tmp := t.TempDir()
+
+	rootFilepath := filepath.Join(tmp, "envy.sh")
+	projectFilepath := filepath.Join(tmp, "project", "envy.sh")
+
+	os.MkdirAll(filepath.Dir(projectFilepath), 0755)
+	os.WriteFile(rootFilepath, []byte("export FOO=bar"), 0644)
+	os.WriteFile(projectFilepath, []byte("export BAR=baz"), 0644)
+
+	parent := NewLayers([]string{rootFilepath})
+	child := NewLayers([]string{rootFilepath, projectFilepath})
+
+	if common := CommonLayers(parent, child); common != 1 {
+		t.Errorf("CommonLayers() = %d, want 1", common)
+	}
+
+	os.WriteFile(rootFilepath, []byte("export FOO=qux"), 0644)
+
+	if common := CommonLayers(child, NewLayers([]string{rootFilepath, projectFilepath})); common != 0 {
+		t.Errorf("CommonLayers() = %d, want 0 once the root file changed", common)
+	}
+}
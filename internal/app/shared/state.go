@@ -0,0 +1,133 @@
+package shared
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// State carries what the stateless hook loaded (ENVY_STATE) so the next run can undo it without any files
+// on disk: the key of the loaded paths, the key of the paths checked last (which differs when loading them
+// failed) and the changes made to the env
+type State struct {
+	Key     string      `json:"key,omitempty"`
+	Checked string      `json:"checked,omitempty"`
+	Changes []EnvChange `json:"changes,omitempty"`
+}
+
+// EncodeState returns the state as gzipped JSON in URL safe base64 so it can be exported without quoting
+func EncodeState(state State) (string, error) {
+	var buf bytes.Buffer
+
+	writer := gzip.NewWriter(&buf)
+
+	err := json.NewEncoder(writer).Encode(state)
+	if err != nil {
+		return "", err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// DecodeState reverses EncodeState; an empty string is the empty state
+func DecodeState(encoded string) (State, error) {
+	var state State
+
+	if len(encoded) == 0 {
+		return state, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return state, err
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return state, err
+	}
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return state, err
+	}
+
+	err = json.Unmarshal(content, &state)
+
+	return state, err
+}
+
+// RevertEnviron undoes changes on KEY=value lines the same way the undo scripts do: additions are removed,
+// removals are restored and changed values are restored unless they were changed again outside of envy
+func RevertEnviron(environ []string, changes []EnvChange) []string {
+	reverts := make(map[string]EnvChange)
+	for _, change := range changes {
+		reverts[change.Key] = change
+	}
+
+	var lines []string
+
+	for _, line := range environ {
+		key, value, _ := strings.Cut(line, "=")
+
+		change, ok := reverts[key]
+		if !ok {
+			lines = append(lines, line)
+			continue
+		}
+
+		delete(reverts, key)
+
+		switch {
+		case len(change.OldValue) == 0:
+			// an addition
+		case len(change.NewValue) == 0 || value == change.NewValue:
+			lines = append(lines, key+"="+change.OldValue)
+		default:
+			lines = append(lines, line)
+		}
+	}
+
+	// removals that are still missing are restored
+	for _, change := range changes {
+		if _, ok := reverts[change.Key]; ok && len(change.OldValue) > 0 && len(change.NewValue) == 0 {
+			lines = append(lines, change.Key+"="+change.OldValue)
+		}
+	}
+
+	return lines
+}
+
+// ApplyEnviron applies changes to KEY=value lines: keys with a new value are set and the others removed
+func ApplyEnviron(environ []string, changes []EnvChange) []string {
+	applies := make(map[string]EnvChange)
+	for _, change := range changes {
+		applies[change.Key] = change
+	}
+
+	var lines []string
+
+	for _, line := range environ {
+		key, _, _ := strings.Cut(line, "=")
+
+		if _, ok := applies[key]; !ok {
+			lines = append(lines, line)
+		}
+	}
+
+	for _, change := range changes {
+		if len(change.NewValue) > 0 {
+			lines = append(lines, change.Key+"="+change.NewValue)
+		}
+	}
+
+	return lines
+}
@@ -0,0 +1,108 @@
+package shared
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestEncodeState(t *testing.T) {
+	state := State{
+		Key:     "abc",
+		Checked: "def",
+		Changes: []EnvChange{{Key: "FOO", NewValue: "bar baz"}, {Key: "PATH", OldValue: "/bin", NewValue: "/a:/bin"}},
+	}
+
+	encoded, err := EncodeState(state)
+	if err != nil {
+		t.Fatalf("EncodeState() unexpected error: %v", err)
+	}
+
+	decoded, err := DecodeState(encoded)
+	if err != nil {
+		t.Fatalf("DecodeState() unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(decoded, state) {
+		t.Errorf("DecodeState() = %+v, want %+v", decoded, state)
+	}
+}
+
+func TestDecodeState(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded string
+		wantErr bool
+	}{
+		{name: "empty", encoded: "", wantErr: false},
+		{name: "not base64", encoded: "!!!", wantErr: true},
+		{name: "not gzip", encoded: "YWJj", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeState(tt.encoded)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DecodeState() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRevertEnviron(t *testing.T) {
+	tests := []struct {
+		name    string
+		environ []string
+		changes []EnvChange
+		want    []string
+	}{
+		{
+			name:    "addition",
+			environ: []string{"HOME=/home/test", "FOO=bar"},
+			changes: []EnvChange{{Key: "FOO", NewValue: "bar"}},
+			want:    []string{"HOME=/home/test"},
+		},
+		{
+			name:    "removal",
+			environ: []string{"HOME=/home/test"},
+			changes: []EnvChange{{Key: "FOO", OldValue: "bar"}},
+			want:    []string{"FOO=bar", "HOME=/home/test"},
+		},
+		{
+			name:    "change",
+			environ: []string{"PATH=/a:/bin"},
+			changes: []EnvChange{{Key: "PATH", OldValue: "/bin", NewValue: "/a:/bin"}},
+			want:    []string{"PATH=/bin"},
+		},
+		{
+			name:    "changed again outside of envy",
+			environ: []string{"PATH=/b:/a:/bin"},
+			changes: []EnvChange{{Key: "PATH", OldValue: "/bin", NewValue: "/a:/bin"}},
+			want:    []string{"PATH=/b:/a:/bin"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := RevertEnviron(tt.environ, tt.changes)
+			slices.Sort(got)
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RevertEnviron() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyEnviron(t *testing.T) {
+	environ := []string{"HOME=/home/test", "PATH=/bin", "OLD=value"}
+	changes := []EnvChange{{Key: "PATH", OldValue: "/bin", NewValue: "/a:/bin"}, {Key: "OLD", OldValue: "value"}, {Key: "FOO", NewValue: "bar"}}
+
+	got := ApplyEnviron(environ, changes)
+	slices.Sort(got)
+
+	if want := []string{"FOO=bar", "HOME=/home/test", "PATH=/a:/bin"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ApplyEnviron() = %v, want %v", got, want)
+	}
+}
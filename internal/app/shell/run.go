@@ -0,0 +1,217 @@
+package shell
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var DefaultTimeout = 10 * time.Second
+
+// how long to wait for the output pipes to close once the subshell has exited or was killed (they can be
+// held open by background processes started from an envy file)
+var waitDelay = time.Second
+
+type TimeoutError struct {
+	Path    string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	if len(e.Path) == 0 {
+		return fmt.Sprintf("timed out after %s", e.Timeout)
+	}
+
+	return fmt.Sprintf("timed out after %s while evaluating %s", e.Timeout, e.Path)
+}
+
+func (e *TimeoutError) FailedPath() string {
+	return e.Path
+}
+
+// EvalError describes a subshell that exited with a non-zero status, pointing at the file (and line when the
+// shell reported one) that was being evaluated along with the shell's error text
+type EvalError struct {
+	Path    string
+	Line    int
+	Message string
+	Err     error
+}
+
+func (e *EvalError) Error() string {
+	message := e.Message
+	if len(message) == 0 {
+		message = e.Err.Error()
+	}
+
+	switch {
+	case len(e.Path) == 0:
+		return message
+	case e.Line > 0:
+		return fmt.Sprintf("%s:%d: %s", e.Path, e.Line, message)
+	default:
+		return fmt.Sprintf("%s: %s", e.Path, message)
+	}
+}
+
+func (e *EvalError) Unwrap() error {
+	return e.Err
+}
+
+func (e *EvalError) FailedPath() string {
+	return e.Path
+}
+
+// FailedPath returns the file that was being evaluated when err happened or an empty string if that isn't
+// known
+func FailedPath(err error) string {
+	var failed interface{ FailedPath() string }
+	if errors.As(err, &failed) {
+		return failed.FailedPath()
+	}
+
+	return ""
+}
+
+// newEvalError picks the shell's error text out of stderr, preferring the last line that points at the file
+// being evaluated (e.g. /a/envy.sh:3: command not found: foo) over the last line written
+func newEvalError(path string, stderr []byte, err error) *EvalError {
+	evalErr := &EvalError{Path: path, Err: err}
+
+	lines := strings.Split(strings.TrimSpace(string(stderr)), "\n")
+
+	for i := len(lines) - 1; i >= 0 && len(path) > 0; i-- {
+		rest, ok := strings.CutPrefix(lines[i], path+":")
+		if !ok {
+			continue
+		}
+
+		lineNumber, message, ok := strings.Cut(rest, ":")
+		if line, err := strconv.Atoi(lineNumber); ok && err == nil {
+			evalErr.Line = line
+			evalErr.Message = strings.TrimSpace(message)
+		} else {
+			evalErr.Message = strings.TrimSpace(rest)
+		}
+
+		return evalErr
+	}
+
+	evalErr.Message = strings.TrimSpace(lines[len(lines)-1])
+
+	return evalErr
+}
+
+// Timeout returns the subshell timeout set in ENVY_TIMEOUT, either as a duration (e.g. 5s) or a number
+// of seconds, falling back to DefaultTimeout when it isn't set or isn't valid
+func Timeout() time.Duration {
+	value := os.Getenv("ENVY_TIMEOUT")
+
+	if timeout, err := time.ParseDuration(value); err == nil && timeout > 0 {
+		return timeout
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	return DefaultTimeout
+}
+
+// Run runs the subshell until it exits, the timeout expires or ctx is cancelled and returns its standard
+// output (the env) while anything written to standard error (warnings and messages from envy files) is
+// passed on to stderr. The subshell runs in its own process group which is killed as a whole when it
+// doesn't finish in time so nothing it started is left behind. Subshells report the path they are
+// evaluating by writing it on a line to fd 3 which is used to tell which file failed or was hanging.
+func Run(ctx context.Context, cmd *exec.Cmd, timeout time.Duration, stderr io.Writer) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	progressReader, progressWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer progressReader.Close()
+
+	var output, errOutput bytes.Buffer
+
+	cmd.Stdout = &output
+	cmd.Stderr = io.MultiWriter(stderr, &errOutput)
+	cmd.ExtraFiles = []*os.File{progressWriter}
+	cmd.WaitDelay = waitDelay
+	setProcessGroup(cmd)
+
+	err = cmd.Start()
+	progressWriter.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	var currentPath string
+
+	progressDone := make(chan struct{})
+	go func() {
+		defer close(progressDone)
+
+		scanner := bufio.NewScanner(progressReader)
+		for scanner.Scan() {
+			mu.Lock()
+			currentPath = scanner.Text()
+			mu.Unlock()
+		}
+	}()
+
+	waitDone := make(chan error, 1)
+	go func() { waitDone <- cmd.Wait() }()
+
+	var killed bool
+
+	select {
+	case err = <-waitDone:
+		if err == nil {
+			return output.Bytes(), nil
+		}
+	case <-ctx.Done():
+		killProcessGroup(cmd)
+		<-waitDone
+		killed = true
+	}
+
+	// give the progress reader a moment to catch up with whatever was written before the subshell ended
+	select {
+	case <-progressDone:
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if !killed {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, newEvalError(currentPath, errOutput.Bytes(), err)
+		}
+
+		return nil, err
+	}
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, &TimeoutError{Path: currentPath, Timeout: timeout}
+	}
+
+	if len(currentPath) == 0 {
+		return nil, ctx.Err()
+	}
+
+	return nil, fmt.Errorf("%w while evaluating %s", ctx.Err(), currentPath)
+}
@@ -0,0 +1,144 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{name: "unset", value: "", want: DefaultTimeout},
+		{name: "duration", value: "1m30s", want: 90 * time.Second},
+		{name: "seconds", value: "5", want: 5 * time.Second},
+		{name: "invalid", value: "soon", want: DefaultTimeout},
+		{name: "negative", value: "-5s", want: DefaultTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ENVY_TIMEOUT", tt.value)
+
+			if got := Timeout(); got != tt.want {
+				t.Errorf("Timeout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		script     string
+		timeout    time.Duration
+		wantOutput string
+		wantStderr string
+		wantErr    string
+	}{
+		{
+			name:       "separate output",
+			script:     "echo /a/envy.sh >&3; echo FOO=bar; echo oops >&2",
+			timeout:    5 * time.Second,
+			wantOutput: "FOO=bar\n",
+			wantStderr: "oops\n",
+		},
+		{
+			name:    "exit status",
+			script:  "exit 3",
+			timeout: 5 * time.Second,
+			wantErr: "exit status 3",
+		},
+		{
+			name:       "failing file and line",
+			script:     "echo /a/envy.sh >&3; echo hello >&2; echo '/a/envy.sh:3: command not found: foo' >&2; exit 1",
+			timeout:    5 * time.Second,
+			wantStderr: "hello\n/a/envy.sh:3: command not found: foo\n",
+			wantErr:    "/a/envy.sh:3: command not found: foo",
+		},
+		{
+			name:       "failing file without a line",
+			script:     "echo /a/envy.sh >&3; echo boom >&2; exit 1",
+			timeout:    5 * time.Second,
+			wantStderr: "boom\n",
+			wantErr:    "/a/envy.sh: boom",
+		},
+		{
+			name:    "timeout reports the file being evaluated",
+			script:  "echo /a/envy.sh >&3; echo /a/b/envy.sh >&3; sleep 10",
+			timeout: 100 * time.Millisecond,
+			wantErr: "timed out after 100ms while evaluating /a/b/envy.sh",
+		},
+		{
+			name:    "timeout kills background processes",
+			script:  "sleep 10 & echo /a/envy.sh >&3; wait",
+			timeout: 100 * time.Millisecond,
+			wantErr: "timed out after 100ms while evaluating /a/envy.sh",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stderr bytes.Buffer
+
+			start := time.Now()
+
+			output, err := Run(context.Background(), exec.Command("sh", "-c", tt.script), tt.timeout, &stderr)
+
+			if time.Since(start) > 5*time.Second {
+				t.Errorf("Run() took %v", time.Since(start))
+			}
+
+			if stderr.String() != tt.wantStderr {
+				t.Errorf("Run() stderr = %q, want %q", stderr.String(), tt.wantStderr)
+			}
+
+			if len(tt.wantErr) > 0 {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("Run() error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Run() unexpected error: %v", err)
+			}
+
+			if string(output) != tt.wantOutput {
+				t.Errorf("Run() output = %q, want %q", output, tt.wantOutput)
+			}
+		})
+	}
+}
+
+func TestRun_Cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+
+	_, err := Run(ctx, exec.Command("sh", "-c", "echo /a/envy.sh >&3; sleep 10"), 10*time.Second, io.Discard)
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run() error = %v, want context.Canceled", err)
+	}
+
+	var timeoutErr *TimeoutError
+	if errors.As(err, &timeoutErr) {
+		t.Error("Run() returned a timeout error for a cancellation")
+	}
+
+	if !strings.HasSuffix(err.Error(), "while evaluating /a/envy.sh") {
+		t.Errorf("Run() error = %v, want the file being evaluated", err)
+	}
+}
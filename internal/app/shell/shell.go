@@ -12,8 +12,9 @@ var SupportedShellTypes = []string{"zsh"}
 
 type Shell interface {
 	Init(w io.Writer) error
-	FindLoadPaths() []string
-	GetSubshellCmd() *exec.Cmd
+	FindLoadPaths(dir string, profile string) []string
+	FindProfiles(dir string) []string
+	GetSubshellCmd(paths []string) *exec.Cmd
 	GenLoadFile(paths []string) ([]string, string)
 	GenUndoFile(changes []shared.EnvChange) ([]string, string)
 }
@@ -20,11 +20,15 @@ func (t *Test) Init(_ io.Writer) error {
 	return nil
 }
 
-func (t *Test) FindLoadPaths() []string {
+func (t *Test) FindLoadPaths(_ string, _ string) []string {
 	return []string{}
 }
 
-func (t *Test) GetSubshellCmd() *exec.Cmd {
+func (t *Test) FindProfiles(_ string) []string {
+	return []string{}
+}
+
+func (t *Test) GetSubshellCmd(_ []string) *exec.Cmd {
 	return exec.Command("echo", "testing 1, 2, 3")
 }
 
@@ -27,16 +27,25 @@ func TestInit(t *testing.T) {
 
 func TestFindLoadPaths(t *testing.T) {
 	test := NewTest("test-session")
-	paths := test.FindLoadPaths()
+	paths := test.FindLoadPaths("/", "")
 
 	if len(paths) != 0 {
 		t.Errorf("FindLoadPaths() = %v, want empty slice", paths)
 	}
 }
 
+func TestFindProfiles(t *testing.T) {
+	test := NewTest("test-session")
+	profiles := test.FindProfiles("/")
+
+	if len(profiles) != 0 {
+		t.Errorf("FindProfiles() = %v, want empty slice", profiles)
+	}
+}
+
 func TestGetSubshellCmd(t *testing.T) {
 	test := NewTest("test-session")
-	cmd := test.GetSubshellCmd()
+	cmd := test.GetSubshellCmd([]string{})
 
 	if cmd == nil {
 		t.Fatal("GetSubshellCmd() returned nil")
@@ -7,7 +7,7 @@ import (
 	"io"
 	"os"
 	"os/exec"
-	"path/filepath"
+	"strings"
 	"text/template"
 )
 
@@ -17,23 +17,20 @@ var envyScriptFilename = "envy.sh"
 
 type Zsh struct {
 	SessionKey   string
+	CacheDir     string
 	LoadFilepath string
 	UndoFilepath string
 }
 
 func NewZsh(sessionKey string) *Zsh {
-	homeDir, _ := os.UserHomeDir()
-
-	cacheDir := filepath.Join(homeDir, ".cache", "envy")
+	cacheDir := shared.CacheDir()
 	os.MkdirAll(cacheDir, 0755)
 
-	loadFilepath := filepath.Join(cacheDir, fmt.Sprintf("%s.load.sh", sessionKey))
-	undoFilepath := filepath.Join(cacheDir, fmt.Sprintf("%s.undo.sh", sessionKey))
-
 	return &Zsh{
 		SessionKey:   sessionKey,
-		LoadFilepath: loadFilepath,
-		UndoFilepath: undoFilepath,
+		CacheDir:     cacheDir,
+		LoadFilepath: shared.SessionFilepath(sessionKey, "load.sh"),
+		UndoFilepath: shared.SessionFilepath(sessionKey, "undo.sh"),
 	}
 }
 
@@ -46,12 +43,26 @@ func (z *Zsh) Init(w io.Writer) error {
 	return t.Execute(w, z)
 }
 
-func (z *Zsh) FindLoadPaths() []string {
-	return shared.FindLoadPaths(envyScriptFilename)
+func (z *Zsh) FindLoadPaths(dir string, profile string) []string {
+	return shared.FindLoadPaths(dir, envyScriptFilename, profile)
 }
 
-func (z *Zsh) GetSubshellCmd() *exec.Cmd {
-	return exec.Command("zsh", "-c", fmt.Sprintf(". %s; envy export", z.LoadFilepath))
+func (z *Zsh) FindProfiles(dir string) []string {
+	return shared.FindProfiles(dir, envyScriptFilename)
+}
+
+func (z *Zsh) GetSubshellCmd(paths []string) *exec.Cmd {
+	var commands []string
+
+	// report each path on fd 3 before sourcing it so a timeout can tell which file was hanging, and send
+	// whatever the files print to stderr so only envy export writes to stdout
+	for _, path := range paths {
+		commands = append(commands, fmt.Sprintf("print -r -u3 -- '%s' 2>/dev/null", path), fmt.Sprintf(". '%s' >&2", path))
+	}
+
+	commands = append(commands, "envy export")
+
+	return exec.Command("zsh", "-c", strings.Join(commands, "; "))
 }
 
 func (z *Zsh) GenLoadFile(paths []string) ([]string, string) {
@@ -78,14 +89,14 @@ func (z *Zsh) GenUndoFile(changes []shared.EnvChange) ([]string, string) {
 			lines = append(lines, fmt.Sprintf("unset %s", change.Key))
 		} else if len(change.NewValue) == 0 {
 			// this was a removal so we need to add it back now
-			// export FOO=bar
-			lines = append(lines, fmt.Sprintf("export %s=%s", change.Key, change.OldValue))
+			// export FOO='bar'
+			lines = append(lines, fmt.Sprintf("export %s=%s", change.Key, shared.ShellQuote(change.OldValue)))
 		} else {
 			// this was a change so we need to change it back now as long as it hasn't been changed outside of envy (thus the check)
-			// if [[ $FOO == "baz" ]]; then
-			//	export FOO=bar
+			// if [[ "${FOO}" == 'baz' ]]; then
+			//	export FOO='bar'
 			// fi
-			lines = append(lines, fmt.Sprintf("if [[ \"${%s}\" == \"%s\" ]]; then \n\texport %s=%s\nfi", change.Key, change.NewValue, change.Key, change.OldValue))
+			lines = append(lines, fmt.Sprintf("if [[ \"${%s}\" == %s ]]; then \n\texport %s=%s\nfi", change.Key, shared.ShellQuote(change.NewValue), change.Key, shared.ShellQuote(change.OldValue)))
 		}
 	}
 
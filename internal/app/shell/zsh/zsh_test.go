@@ -17,6 +17,10 @@ func TestNewZsh(t *testing.T) {
 		t.Errorf("expected SessionKey %s, got %s", sessionKey, z.SessionKey)
 	}
 
+	if z.CacheDir != shared.CacheDir() {
+		t.Errorf("expected CacheDir %s, got %s", shared.CacheDir(), z.CacheDir)
+	}
+
 	homeDir, _ := os.UserHomeDir()
 	expectedLoadFilepath := filepath.Join(homeDir, ".cache/envy", "test-session.load.sh")
 	expectedUndoFilepath := filepath.Join(homeDir, ".cache/envy", "test-session.undo.sh")
@@ -37,29 +41,41 @@ func TestZsh_Init(t *testing.T) {
 		checkSessionKey       string
 		checkExecLoadFilepath string
 		checkExecUndoFilepath string
-		checkRmLoadFilepath   string
-		checkRmUndoFilepath   string
+		checkRmSessionFiles   string
+		checkPrecmdHook       string
+		checkStatelessHook    string
+		checkReinit           []string
 		wantErr               bool
 	}{
 		{
 			name: "success",
 			z: &Zsh{
 				SessionKey:   "test-session",
+				CacheDir:     "/tmp",
 				LoadFilepath: "/tmp/test-session.load.sh",
 				UndoFilepath: "/tmp/test-session.undo.sh",
 			},
 			initScript:            initScript,
-			checkSessionKey:       "ENVY_SESSION_KEY=test-session",
+			checkSessionKey:       "ENVY_SESSION_KEY=test-session\nexport ENVY_SESSION_PID=$$",
 			checkExecLoadFilepath: ". /tmp/test-session.load.sh",
 			checkExecUndoFilepath: ". /tmp/test-session.undo.sh",
-			checkRmLoadFilepath:   "rm /tmp/test-session.load.sh",
-			checkRmUndoFilepath:   "rm /tmp/test-session.undo.sh",
+			checkRmSessionFiles:   "rm -f /tmp/test-session.*",
+			checkPrecmdHook:       "add-zsh-hook precmd envy_precmd_hook",
+			checkStatelessHook:    `eval "$(envy hook)"`,
+			checkReinit: []string{
+				`"$ENVY_SESSION_KEY" != test-session && "$ENVY_SESSION_PID" == $$ ]]; then
+  envy_previous_session_keys+=($ENVY_SESSION_KEY)`,
+				"for key in $envy_previous_session_keys; do\n      rm -f /tmp/$key.*",
+				"add-zsh-hook -d precmd envy_precmd_hook",
+				"add-zsh-hook -d precmd envy_chpwd_hook",
+			},
 
 			wantErr: false,
 		}, {
 			name: "error",
 			z: &Zsh{
 				SessionKey:   "test-session",
+				CacheDir:     "/tmp",
 				LoadFilepath: "/tmp/test-session.load.sh",
 				UndoFilepath: "/tmp/test-session.undo.sh",
 			},
@@ -91,11 +107,19 @@ func TestZsh_Init(t *testing.T) {
 				if !strings.Contains(output, tt.checkExecUndoFilepath) {
 					t.Errorf("expected output to contain %q", tt.checkExecUndoFilepath)
 				}
-				if !strings.Contains(output, tt.checkRmLoadFilepath) {
-					t.Errorf("expected output to contain %q", tt.checkRmLoadFilepath)
+				if !strings.Contains(output, tt.checkRmSessionFiles) {
+					t.Errorf("expected output to contain %q", tt.checkRmSessionFiles)
+				}
+				if !strings.Contains(output, tt.checkPrecmdHook) {
+					t.Errorf("expected output to contain %q", tt.checkPrecmdHook)
 				}
-				if !strings.Contains(output, tt.checkRmUndoFilepath) {
-					t.Errorf("expected output to contain %q", tt.checkRmUndoFilepath)
+				if !strings.Contains(output, tt.checkStatelessHook) {
+					t.Errorf("expected output to contain %q", tt.checkStatelessHook)
+				}
+				for _, check := range tt.checkReinit {
+					if !strings.Contains(output, check) {
+						t.Errorf("expected output to contain %q", check)
+					}
 				}
 			}
 		})
@@ -107,22 +131,43 @@ func TestZsh_FindLoadPaths(t *testing.T) {
 	// no other processing/logic, therefore no real testing is done here
 	z := &Zsh{}
 
-	z.FindLoadPaths()
+	z.FindLoadPaths("/", "")
 }
 
 func TestZsh_GetSubshellCmd(t *testing.T) {
 	z := &Zsh{LoadFilepath: "/tmp/load.sh"}
-	cmd := z.GetSubshellCmd()
 
-	expectedArgs := []string{"zsh", "-c", ". /tmp/load.sh; envy export"}
-	if len(cmd.Args) != len(expectedArgs) {
-		t.Fatalf("expected %d args, got %d", len(expectedArgs), len(cmd.Args))
+	tests := []struct {
+		name         string
+		paths        []string
+		expectedArgs []string
+	}{
+		{
+			name:         "no paths",
+			paths:        []string{},
+			expectedArgs: []string{"zsh", "-c", "envy export"},
+		},
+		{
+			name:         "multiple paths",
+			paths:        []string{"/a/envy.sh", "/a/b/envy.sh"},
+			expectedArgs: []string{"zsh", "-c", "print -r -u3 -- '/a/envy.sh' 2>/dev/null; . '/a/envy.sh' >&2; print -r -u3 -- '/a/b/envy.sh' 2>/dev/null; . '/a/b/envy.sh' >&2; envy export"},
+		},
 	}
 
-	for i := range cmd.Args {
-		if cmd.Args[i] != expectedArgs[i] {
-			t.Errorf("arg %d: expected %s, got %s", i, expectedArgs[i], cmd.Args[i])
-		}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := z.GetSubshellCmd(tt.paths)
+
+			if len(cmd.Args) != len(tt.expectedArgs) {
+				t.Fatalf("expected %d args, got %d", len(tt.expectedArgs), len(cmd.Args))
+			}
+
+			for i := range cmd.Args {
+				if cmd.Args[i] != tt.expectedArgs[i] {
+					t.Errorf("arg %d: expected %s, got %s", i, tt.expectedArgs[i], cmd.Args[i])
+				}
+			}
+		})
 	}
 }
 
@@ -213,7 +258,7 @@ func TestZsh_GenUndoFile(t *testing.T) {
 			},
 			expectedLines: []string{
 				"#!/bin/zsh",
-				"export OLD_VAR=old_val",
+				"export OLD_VAR='old_val'",
 			},
 		},
 		{
@@ -223,7 +268,7 @@ func TestZsh_GenUndoFile(t *testing.T) {
 			},
 			expectedLines: []string{
 				"#!/bin/zsh",
-				"if [[ \"${MOD_VAR}\" == \"new\" ]]; then \n\texport MOD_VAR=old\nfi",
+				"if [[ \"${MOD_VAR}\" == 'new' ]]; then \n\texport MOD_VAR='old'\nfi",
 			},
 		},
 		{
@@ -236,8 +281,20 @@ func TestZsh_GenUndoFile(t *testing.T) {
 			expectedLines: []string{
 				"#!/bin/zsh",
 				"unset ADD",
-				"export REM=2",
-				"if [[ \"${MOD}\" == \"4\" ]]; then \n\texport MOD=3\nfi",
+				"export REM='2'",
+				"if [[ \"${MOD}\" == '4' ]]; then \n\texport MOD='3'\nfi",
+			},
+		},
+		{
+			name: "values with spaces, quotes and metacharacters",
+			changes: []shared.EnvChange{
+				{Key: "LESS", OldValue: "-R -F", NewValue: ""},
+				{Key: "CMD", OldValue: "a; $(rm -rf x)", NewValue: "it's `b`"},
+			},
+			expectedLines: []string{
+				"#!/bin/zsh",
+				"export LESS='-R -F'",
+				"if [[ \"${CMD}\" == 'it'\\''s `b`' ]]; then \n\texport CMD='a; $(rm -rf x)'\nfi",
 			},
 		},
 	}